@@ -0,0 +1,122 @@
+package freelruotel
+
+import (
+	"sync"
+
+	"github.com/elastic/go-freelru"
+)
+
+// counterCarry sums the counters of a changing set of caches without the sums ever decreasing, as
+// exporters take a decreasing counter for a reset. When a cache leaves the set, e.g. because it was
+// uninstrumented, or one of its counters starts over, e.g. after ReplaceCache, its last values are
+// carried into the sums.
+//
+// A collection starts with begin, passes every cache of the set to update or keep, and ends with end.
+// Each call only holds the lock for itself, so user code run during the collection, e.g. a panicking
+// Len, can't leave it locked. A collection cut short just doesn't call end.
+type counterCarry struct {
+	mu       sync.Mutex
+	counters []counter
+
+	// last holds the last values of the caches in the set by entry id: one per counter, followed by
+	// the purges recorded by RecordPurge
+	last map[uint64]*carriedValues
+
+	// carried holds the values of caches that left the set and of counters that started over
+	carried []uint64
+
+	// gen counts the collections, telling the caches that are still in the set from the others
+	gen uint64
+
+	// active is set once a cache joined the set, from which on the sums are reported
+	active bool
+}
+
+// carriedValues holds the last values of a cache and the latest collection it was seen in
+type carriedValues struct {
+	values []uint64
+	gen    uint64
+}
+
+// newCounterCarry creates a counterCarry summing counters
+func newCounterCarry(counters []counter) *counterCarry {
+	return &counterCarry{
+		counters: counters,
+		last:     make(map[uint64]*carriedValues),
+		carried:  make([]uint64, len(counters)+1),
+	}
+}
+
+// begin starts a collection and returns its generation, which is passed to the other calls
+func (c *counterCarry) begin() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	return c.gen
+}
+
+// update sets the values of the cache with the given id, which is part of the set in collection gen.
+// Values read by a collection that was overtaken by a later one are dropped, as they may be older.
+func (c *counterCarry) update(gen, id uint64, metrics freelru.Metrics, purges uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active = true
+	last, ok := c.last[id]
+	if !ok {
+		last = &carriedValues{values: make([]uint64, len(c.carried))}
+		c.last[id] = last
+	}
+	if gen < last.gen {
+		return
+	}
+	last.gen = gen
+
+	for i, counter := range c.counters {
+		c.set(last, i, counter.value(metrics))
+	}
+	c.set(last, len(c.counters), purges)
+}
+
+// set stores value as the i-th value of last, carrying the previous one if the counter started over
+func (c *counterCarry) set(last *carriedValues, i int, value uint64) {
+	if value < last.values[i] {
+		c.carried[i] = addSaturating(c.carried[i], last.values[i])
+	}
+	last.values[i] = value
+}
+
+// keep keeps the cache with the given id in the set of collection gen with its last values, e.g.
+// while it's disabled or its metrics can't be read
+func (c *counterCarry) keep(gen, id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.last[id]; ok && gen > last.gen {
+		last.gen = gen
+	}
+}
+
+// end carries the values of the caches neither updated nor kept in collection gen or a later one,
+// which left the set, and returns the sums: one per counter, followed by the purges. ok is false
+// until a cache joined the set.
+func (c *counterCarry) end(gen uint64) (sums []uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sums = make([]uint64, len(c.carried))
+	copy(sums, c.carried)
+	for id, last := range c.last {
+		if last.gen < gen {
+			for i, value := range last.values {
+				c.carried[i] = addSaturating(c.carried[i], value)
+			}
+			delete(c.last, id)
+		}
+		for i, value := range last.values {
+			sums[i] = addSaturating(sums[i], value)
+		}
+	}
+	return sums, c.active
+}
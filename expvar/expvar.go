@@ -0,0 +1,29 @@
+// Package expvar exposes the metrics of instrumented freelru caches through the standard
+// expvar package, so they can be inspected at /debug/vars without an OpenTelemetry pipeline.
+//
+// It lives in its own package because importing expvar registers the /debug/vars handler
+// on http.DefaultServeMux.
+package expvar
+
+import (
+	"expvar"
+
+	freelruotel "github.com/sweet-tv/freelru-otel"
+)
+
+// Publish exposes the metrics of every cache instrumented with the package-level functions
+// of freelruotel under name. Like expvar.Publish, it panics if name is already in use.
+func Publish(name string) {
+	expvar.Publish(name, Func(nil))
+}
+
+// Func returns an expvar.Func reporting the metrics of every cache instrumented by i, keyed by
+// cache name. A nil Instrumenter reports the caches of the package-level functions.
+func Func(i *freelruotel.Instrumenter) expvar.Func {
+	return func() any {
+		if i == nil {
+			return freelruotel.Snapshots()
+		}
+		return i.Snapshots()
+	}
+}
@@ -0,0 +1,73 @@
+package expvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/elastic/go-freelru"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+)
+
+func hashStringXXHASH(s string) uint32 {
+	return uint32(xxhash.Sum64String(s))
+}
+
+func TestPublish(t *testing.T) {
+	cache, err := freelru.New[string, string](10, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	if err := freelruotel.InstrumentCache(cache, "expvar_cache"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	defer freelruotel.UninstrumentCache("expvar_cache")
+
+	Publish("freelru_test")
+
+	cache.Add("key", "value")
+	cache.Get("key") // hit
+	cache.Get("key") // hit
+
+	published := expvar.Get("freelru_test")
+	if published == nil {
+		t.Fatal("Expected published expvar")
+	}
+
+	var metrics map[string]freelru.Metrics
+	if err := json.Unmarshal([]byte(published.String()), &metrics); err != nil {
+		t.Fatalf("Failed to decode expvar JSON: %v", err)
+	}
+
+	if metrics["expvar_cache"].Hits != 2 {
+		t.Errorf("Expected 2 hits, got %d", metrics["expvar_cache"].Hits)
+	}
+}
+
+func TestFuncWithInstrumenter(t *testing.T) {
+	cache, err := freelru.NewSynced[string, string](10, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	instrumenter := freelruotel.New()
+	if err := instrumenter.Instrument(cache, "instrumenter_cache"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	cache.Get("missing") // miss
+
+	var metrics map[string]freelru.Metrics
+	if err := json.Unmarshal([]byte(Func(instrumenter).String()), &metrics); err != nil {
+		t.Fatalf("Failed to decode expvar JSON: %v", err)
+	}
+
+	if len(metrics) != 1 {
+		t.Errorf("Expected 1 cache, got %d", len(metrics))
+	}
+	if metrics["instrumenter_cache"].Misses != 1 {
+		t.Errorf("Expected 1 miss, got %d", metrics["instrumenter_cache"].Misses)
+	}
+}
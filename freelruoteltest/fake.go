@@ -0,0 +1,42 @@
+// Package freelruoteltest provides test helpers for code using freelruotel, so instrumentation
+// wiring can be tested without real freelru caches.
+package freelruoteltest
+
+import (
+	"sync"
+
+	"github.com/elastic/go-freelru"
+)
+
+// FakeCache is a freelruotel.MetricsProvider reporting the metrics set on it.
+// The zero value reports zero for every counter. It is safe for concurrent use.
+type FakeCache struct {
+	mu      sync.Mutex
+	metrics freelru.Metrics
+}
+
+// NewFakeCache returns a FakeCache reporting metrics.
+func NewFakeCache(metrics freelru.Metrics) *FakeCache {
+	return &FakeCache{metrics: metrics}
+}
+
+// Metrics returns the metrics last set on the cache.
+func (c *FakeCache) Metrics() freelru.Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.metrics
+}
+
+// SetMetrics replaces the metrics reported by the cache.
+func (c *FakeCache) SetMetrics(metrics freelru.Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = metrics
+}
+
+// Update calls fn with the metrics reported by the cache, so individual counters can be changed.
+func (c *FakeCache) Update(fn func(*freelru.Metrics)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.metrics)
+}
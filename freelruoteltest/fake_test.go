@@ -0,0 +1,74 @@
+package freelruoteltest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/go-freelru"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestFakeCache(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := NewFakeCache(freelru.Metrics{
+		Hits:       1,
+		Misses:     2,
+		Inserts:    3,
+		Evictions:  4,
+		Collisions: 5,
+	})
+	cache.Update(func(m *freelru.Metrics) {
+		m.Removals = 6
+	})
+
+	var _ freelruotel.MetricsProvider = cache
+	if err := freelruotel.New().Instrument(cache, "fake", freelruotel.WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := &metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+
+	expected := map[string]int64{
+		"cache.hit":       1,
+		"cache.miss":      2,
+		"cache.insert":    3,
+		"cache.eviction":  4,
+		"cache.collision": 5,
+		"cache.removal":   6,
+	}
+	found := 0
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		value, ok := expected[m.Name]
+		if !ok {
+			continue
+		}
+		found++
+
+		dps := m.Data.(metricdata.Sum[int64]).DataPoints
+		if len(dps) != 1 || dps[0].Value != value {
+			t.Errorf("Expected %s %d, got %v", m.Name, value, dps)
+		}
+	}
+	if found != len(expected) {
+		t.Errorf("Expected %d counters, found %d", len(expected), found)
+	}
+}
+
+func TestFakeCacheSetMetrics(t *testing.T) {
+	var cache FakeCache
+	if cache.Metrics() != (freelru.Metrics{}) {
+		t.Errorf("Expected zero metrics, got %+v", cache.Metrics())
+	}
+
+	cache.SetMetrics(freelru.Metrics{Hits: 10})
+	if cache.Metrics().Hits != 10 {
+		t.Errorf("Expected 10 hits, got %d", cache.Metrics().Hits)
+	}
+}
@@ -0,0 +1,24 @@
+package freelruotel
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns an http.Handler serving the metrics of every cache instrumented with the
+// package-level functions as JSON. See Instrumenter.Handler for details.
+func Handler() http.Handler {
+	return defaultInstrumenter.Handler()
+}
+
+// Handler returns an http.Handler serving the metrics of every cache instrumented by i as a JSON
+// object keyed by cache name, in the same format as the expvar subpackage. It's meant for services
+// without an OpenTelemetry pipeline, development and liveness probes.
+func (i *Instrumenter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(i.Snapshots()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
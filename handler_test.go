@@ -0,0 +1,60 @@
+package freelruotel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-freelru"
+)
+
+func TestHandler(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	cache := mustCreateLRUCache()
+	cache.Add("key", "value")
+	cache.Get("key")     // hit
+	cache.Get("missing") // miss
+	if err := InstrumentCache(cache, "sessions"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 7}}, "products"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to GET metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", contentType)
+	}
+
+	var metrics map[string]freelru.Metrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+
+	expected := map[string]freelru.Metrics{
+		"sessions": {Inserts: 1, Hits: 1, Misses: 1},
+		"products": {Hits: 7},
+	}
+	if len(metrics) != len(expected) {
+		t.Errorf("Expected %d caches, got %d", len(expected), len(metrics))
+	}
+	for name, want := range expected {
+		if got := metrics[name]; got != want {
+			t.Errorf("Cache %s: expected %+v, got %+v", name, want, got)
+		}
+	}
+}
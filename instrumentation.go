@@ -2,34 +2,248 @@ package freelruotel
 
 import (
 	"context"
-	"sync"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/elastic/go-freelru"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// version is the current version of the instrumentation library.
-var version = "v0.2.0"
+// defaultMeterName is the default name of the instrumentation scope.
+const defaultMeterName = DefaultScopeName
 
-// Global state for tracking multiple cache instances
-var (
-	registry    = &cacheRegistry{}
-	metricsOnce sync.Once
-)
+// defaultCacheNameKey is the default attribute key identifying the cache on every data point.
+const defaultCacheNameKey = AttributeCacheName
+
+// cacheTypeKey is the attribute key carrying the kind of the cache.
+const cacheTypeKey = AttributeCacheType
+
+// namespaceKey is the attribute key carrying the namespace set by WithNamespace.
+const namespaceKey = AttributeNamespace
+
+// defaultInstrumenter backs the package-level functions
+var defaultInstrumenter = New()
 
 // MetricsProvider is an interface for freelru cache implementations that can provide metrics.
-// freelru.LRU, freelru.SyncedLRU and freelru.ShardedLRU implement this interface.
+// freelru.LRU, freelru.SyncedLRU and freelru.ShardedLRU implement this interface for any key
+// and value type parameters.
 type MetricsProvider interface {
 	Metrics() freelru.Metrics
 }
 
+// The freelru caches implement MetricsProvider whichever constructor and hasher they were created with
+var (
+	_ MetricsProvider = (*freelru.LRU[string, string])(nil)
+	_ MetricsProvider = (*freelru.SyncedLRU[string, string])(nil)
+	_ MetricsProvider = (*freelru.ShardedLRU[string, string])(nil)
+)
+
+// MetricsFunc is an adapter to use an ordinary function as a MetricsProvider,
+// so any source of counts can be instrumented.
+type MetricsFunc func() freelru.Metrics
+
+// Metrics calls f.
+func (f MetricsFunc) Metrics() freelru.Metrics {
+	return f()
+}
+
+// Metrics mirrors freelru.Metrics, so packages wrapping freelru can report their counts without
+// importing freelru themselves.
+type Metrics struct {
+	Inserts    uint64
+	Collisions uint64
+	Evictions  uint64
+	Removals   uint64
+	Hits       uint64
+	Misses     uint64
+}
+
+// StatsFunc is an adapter to use a function returning Metrics as a MetricsProvider,
+// e.g. a method value of a type wrapping a freelru cache.
+type StatsFunc func() Metrics
+
+// Metrics calls f, converting the result to freelru.Metrics.
+func (f StatsFunc) Metrics() freelru.Metrics {
+	return freelru.Metrics(f())
+}
+
+// SizeProvider is an optional interface for caches that can report their current number of entries.
+// freelru.LRU, freelru.SyncedLRU and freelru.ShardedLRU implement this interface.
+type SizeProvider interface {
+	Len() int
+}
+
+// CapacityProvider is an optional interface for caches that can report their configured capacity.
+// The capacity of freelru caches is detected without it, so implement it for other caches.
+type CapacityProvider interface {
+	Cap() int
+}
+
+// ShardsProvider is an optional interface for caches that can report their number of shards.
+// The shards of freelru caches are detected without it, so implement it for other caches.
+type ShardsProvider interface {
+	Shards() int
+}
+
+// KindProvider is an optional interface for caches reporting their kind as the cache_type attribute.
+// freelru caches are detected without it, so implement it for wrappers and other caches.
+type KindProvider interface {
+	Kind() string
+}
+
+// Namer is implemented by caches that know the name they're instrumented under.
+type Namer interface {
+	CacheName() string
+}
+
 // Option is a functional option for configuring cache instrumentation.
+//
+// Metrics are registered once per MeterProvider, by the first call using it. Options shaping the
+// registered metrics, like their names, attributes and collection settings, are taken from that call;
+// later calls passing other values for them don't change the metrics. The options this applies to
+// say so.
 type Option func(*config)
 
 type config struct {
-	meterProvider metric.MeterProvider
+	meterProvider   metric.MeterProvider
+	tracerProvider  trace.TracerProvider
+	meterOverride   metric.Meter
+	meterName       string
+	meterVersion    string
+	attributes      []attribute.KeyValue
+	cacheAttributes []attribute.KeyValue
+	dynamicAttrs    func() []attribute.KeyValue
+	expiredFunc     func() int
+	namespace       string
+	metricPrefix    string
+	separator       string
+	renames         map[string]string
+	aliases         map[string]string
+	cacheNameKey    string
+	units           map[string]string
+	descriptions    map[string]string
+	disabled        map[string]bool
+	aggregate       bool
+	cardinality     int
+	cardinalityWarn int
+	sizeAsUpDown    bool
+	skipZero        bool
+	nameSanitizer   func(string) string
+	nameFilter      func(string) bool
+	logger          *slog.Logger
+	snapshotTTL     time.Duration
+	observeTimeout  time.Duration
+	baggageKeys     []string
+
+	// err holds the first validation error reported by an option
+	err error
+}
+
+// newConfig returns a config holding the defaults
+func newConfig() *config {
+	return &config{
+		meterProvider:  otel.GetMeterProvider(),
+		tracerProvider: otel.GetTracerProvider(),
+		meterName:      defaultMeterName,
+		meterVersion:   version,
+		cacheNameKey:   defaultCacheNameKey,
+	}
+}
+
+// setErr records err unless an earlier option already reported one
+func (c *config) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// errNilMeter is returned when no meter can be obtained to register the metrics with
+var errNilMeter = errors.New("meter provider returned a nil meter")
+
+// meter returns the meter the metrics are registered with, nil if the provider is nil or returns none
+func (c *config) meter() metric.Meter {
+	if c.meterOverride != nil {
+		return c.meterOverride
+	}
+	if c.meterProvider == nil {
+		return nil
+	}
+	return c.meterProvider.Meter(c.meterName, metric.WithInstrumentationVersion(c.meterVersion))
+}
+
+// unit returns the unit of the metric with the given unprefixed name
+func (c *config) unit(name string) string {
+	if unit, ok := c.units[name]; ok {
+		return unit
+	}
+	return metricDefinitions[name].unit
+}
+
+// description returns the description of the metric with the given unprefixed name
+func (c *config) description(name string) string {
+	if description, ok := c.descriptions[name]; ok {
+		return description
+	}
+	return metricDefinitions[name].description
+}
+
+// metricName returns the instrument name for name, including the configured prefix
+func (c *config) metricName(name string) string {
+	if renamed, ok := c.renames[name]; ok {
+		name = renamed
+	}
+	if c.metricPrefix != "" {
+		name = c.metricPrefix + "." + name
+	}
+	if c.separator == "" || c.separator == "." {
+		return name
+	}
+	return strings.ReplaceAll(name, ".", c.separator)
+}
+
+// reportedName returns name as reported in the cache name attribute
+func (c *config) reportedName(name string) string {
+	if c.nameSanitizer == nil {
+		return name
+	}
+	return c.nameSanitizer(name)
+}
+
+// appendNamespace appends the namespace attribute to kvs, if a namespace is set
+func (c *config) appendNamespace(kvs []attribute.KeyValue) []attribute.KeyValue {
+	if c.namespace == "" {
+		return kvs
+	}
+	return append(kvs, attribute.String(namespaceKey, c.namespace))
+}
+
+// log emits a record with the configured logger, if any, skipping disabled levels before
+// building the record
+func (c *config) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if c.logger == nil || !c.logger.Enabled(ctx, level) {
+		return
+	}
+	c.logger.Log(ctx, level, msg, args...)
+}
+
+// entryAttributes returns the attributes of the data points of entry
+func (c *config) entryAttributes(entry *cacheEntry) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(c.attributes)+len(entry.attributes)+3)
+	kvs = append(kvs, c.attributes...)
+	kvs = append(kvs, attribute.String(cacheTypeKey, entry.kind))
+	kvs = append(kvs, entry.attributes...)
+	// The namespace and cache name go last, as the last value of a duplicate key wins
+	kvs = c.appendNamespace(kvs)
+	return append(kvs, attribute.String(c.cacheNameKey, entry.reportedName))
 }
 
 // WithMeterProvider sets a custom MeterProvider for the instrumentation.
@@ -39,92 +253,604 @@ func WithMeterProvider(provider metric.MeterProvider) Option {
 	}
 }
 
-// InstrumentCache registers OpenTelemetry Observable Counter metrics of any instance of freelru cache.
-func InstrumentCache(cache MetricsProvider, name string, opts ...Option) error {
-	cfg := &config{
-		meterProvider: otel.GetMeterProvider(),
+// WithTracerProvider sets the TracerProvider of the spans started by WarmCache, the global one by default.
+// The tracer uses the instrumentation scope set with WithMeterName and WithInstrumentationVersion.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		if provider == nil {
+			c.setErr(errors.New("tracer provider must not be nil"))
+			return
+		}
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeter registers the metrics with meter instead of a meter obtained from the MeterProvider.
+// It takes precedence over WithMeterProvider, WithMeterName and WithInstrumentationVersion.
+func WithMeter(meter metric.Meter) Option {
+	return func(c *config) {
+		c.meterOverride = meter
+	}
+}
+
+// WithMeterName sets the name of the instrumentation scope, "github.com/sweet-tv/freelru-otel" by default.
+func WithMeterName(name string) Option {
+	return func(c *config) {
+		if name == "" {
+			c.setErr(errors.New("meter name must not be empty"))
+			return
+		}
+		c.meterName = name
+	}
+}
+
+// WithInstrumentationVersion sets the version of the instrumentation scope,
+// which defaults to the version of this library.
+func WithInstrumentationVersion(version string) Option {
+	return func(c *config) {
+		c.meterVersion = version
+	}
+}
+
+// WithAttributes adds static attributes to every data point emitted by the instrumentation.
+// Attributes using the cache name key are overridden by the cache name.
+// It's taken from the call that registers the metrics, see Option.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.attributes = append(c.attributes, attrs...)
+	}
+}
+
+// deploymentStages lists the stages accepted by WithDeployment
+var deploymentStages = []string{"canary", "stable", "blue", "green"}
+
+// WithDeployment adds a deployment attribute with the given stage, one of canary, stable, blue or
+// green. Other stages make InstrumentCache fail.
+func WithDeployment(stage string) Option {
+	return func(c *config) {
+		if !slices.Contains(deploymentStages, stage) {
+			c.setErr(fmt.Errorf("unknown deployment stage %q, expected one of %s",
+				stage, strings.Join(deploymentStages, ", ")))
+			return
+		}
+		c.attributes = append(c.attributes, attribute.String(AttributeDeployment, stage))
+	}
+}
+
+// WithConstLabelsFromEnv adds attributes like WithAttributes, taking their values from environment
+// variables, e.g. the pod and node names injected by Kubernetes. labels maps attribute keys to the
+// names of the variables. The variables are read when the option is applied, and unset ones are skipped.
+func WithConstLabelsFromEnv(labels map[string]string) Option {
+	return func(c *config) {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if value, ok := os.LookupEnv(labels[key]); ok {
+				c.attributes = append(c.attributes, attribute.String(key, value))
+			}
+		}
+	}
+}
+
+// WithNamespace adds a "namespace" attribute with the value ns to every data point, e.g. to tell
+// services apart when the MeterProvider has no resource attributes. Unlike the attributes set by
+// WithAttributes, it can't be overridden by WithCacheAttributes. An empty namespace is rejected.
+func WithNamespace(ns string) Option {
+	return func(c *config) {
+		if ns == "" {
+			c.setErr(errors.New("namespace must not be empty"))
+			return
+		}
+		c.namespace = ns
+	}
+}
+
+// WithDynamicAttributes adds the attributes returned by fn to the data points of every metric, e.g.
+// the current leader or follower role of the process. fn is called once per collection, so the
+// attributes can change over the lifetime of the process. Other attributes with the same keys take
+// precedence. It's taken from the call that registers the metrics, see Option.
+func WithDynamicAttributes(fn func() []attribute.KeyValue) Option {
+	return func(c *config) {
+		c.dynamicAttrs = fn
+	}
+}
+
+// WithCacheAttributes adds attributes to the data points of the cache being instrumented only.
+// They are merged with the attributes set by WithAttributes, and can't override the cache name.
+func WithCacheAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.cacheAttributes = append(c.cacheAttributes, attrs...)
+	}
+}
+
+// WithExpiredFunc reports the result of fn as the cache.expired gauge of the cache being instrumented.
+// freelru doesn't expose how many entries outlived their lifetime without being removed yet, so fn
+// has to count them, e.g. by tracking the lifetimes passed to AddWithLifetime.
+func WithExpiredFunc(fn func() int) Option {
+	return func(c *config) {
+		c.expiredFunc = fn
+	}
+}
+
+// WithCacheNameKey sets the attribute key carrying the cache name, "cache_name" by default.
+// It's taken from the call that registers the metrics, see Option.
+func WithCacheNameKey(key string) Option {
+	return func(c *config) {
+		if key == "" {
+			c.setErr(errors.New("cache name key must not be empty"))
+			return
+		}
+		c.cacheNameKey = key
+	}
+}
+
+// WithMetricPrefix prepends prefix and a "." separator to every metric name, e.g. "checkout.cache.hit".
+// The separator can be changed with WithMetricSeparator. Trailing dots in prefix are ignored, and an
+// empty prefix is rejected, as are prefixes not starting with an ASCII letter or containing characters
+// other than ASCII letters, digits and "_.-/", which instrument names can't hold.
+// It's taken from the call that registers the metrics, see Option.
+func WithMetricPrefix(prefix string) Option {
+	return func(c *config) {
+		prefix = strings.TrimRight(prefix, ".")
+		if prefix == "" {
+			c.setErr(errors.New("metric prefix must not be empty"))
+			return
+		}
+		if !validMetricPrefix(prefix) {
+			c.setErr(fmt.Errorf("metric prefix %q is not a valid start of an instrument name", prefix))
+			return
+		}
+		c.metricPrefix = prefix
+	}
+}
+
+// validMetricPrefix reports whether prefix can start an instrument name: an ASCII letter followed by
+// ASCII letters, digits and "_.-/"
+func validMetricPrefix(prefix string) bool {
+	for i, r := range prefix {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || strings.ContainsRune("_.-/", r)):
+		default:
+			return false
+		}
 	}
+	return true
+}
+
+// metricSeparators lists the separators accepted by WithMetricSeparator, the characters other than
+// letters and digits allowed in instrument names
+var metricSeparators = []string{".", "_", "-", "/"}
 
-	// Apply options
-	for _, opt := range opts {
-		opt(cfg)
+// WithMetricSeparator replaces every "." in the metric names with sep, including the one joining the
+// prefix set with WithMetricPrefix, e.g. "checkout_cache_hit" for sep "_" and prefix "checkout". Dots
+// in the prefix itself are replaced as well. sep must be one of ".", "_", "-" and "/", "." by default.
+// It's taken from the call that registers the metrics, see Option.
+func WithMetricSeparator(sep string) Option {
+	return func(c *config) {
+		if !slices.Contains(metricSeparators, sep) {
+			c.setErr(fmt.Errorf("metric separator must be one of %q, got %q", metricSeparators, sep))
+			return
+		}
+		c.separator = sep
 	}
+}
 
-	// Add the cache to our global registry
-	if err := registry.add(cache, name); err != nil {
-		return err
+// WithCollisionMetricName registers cache.collision under name instead, e.g. "cache.hash_collision"
+// for users unfamiliar with freelru's hash table. The metric prefix still applies. An empty name is
+// rejected. It's taken from the call that registers the metrics, see Option.
+func WithCollisionMetricName(name string) Option {
+	return func(c *config) {
+		if name == "" {
+			c.setErr(errors.New("collision metric name must not be empty"))
+			return
+		}
+		if c.renames == nil {
+			c.renames = make(map[string]string)
+		}
+		c.renames[MetricCacheCollision] = name
 	}
+}
 
-	// Register metrics only once using sync.Once
-	var err error
-	metricsOnce.Do(func() {
-		meter := cfg.meterProvider.Meter("github.com/sweet-tv/freelru-otel",
-			metric.WithInstrumentationVersion(version))
-		if meter != nil {
-			err = registerAllMetrics(meter)
+// WithUnit overrides the UCUM unit of the metric with the given unprefixed name, e.g. "cache.hit".
+// Counters default to annotations like "{hit}", ratios to "1". Unknown metric names are rejected.
+// It's taken from the call that registers the metrics, see Option.
+func WithUnit(name, unit string) Option {
+	return func(c *config) {
+		if _, ok := metricDefinitions[name]; !ok {
+			c.setErr(fmt.Errorf("unknown metric '%s'", name))
+			return
 		}
-	})
+		if c.units == nil {
+			c.units = make(map[string]string)
+		}
+		c.units[name] = unit
+	}
+}
 
-	return err
+// WithMetricDescription overrides the description of the metric with the given unprefixed name,
+// e.g. "cache.hit". Unknown metric names are rejected.
+// It's taken from the call that registers the metrics, see Option.
+func WithMetricDescription(name, description string) Option {
+	return func(c *config) {
+		if _, ok := metricDefinitions[name]; !ok {
+			c.setErr(fmt.Errorf("unknown metric '%s'", name))
+			return
+		}
+		if c.descriptions == nil {
+			c.descriptions = make(map[string]string)
+		}
+		c.descriptions[name] = description
+	}
 }
 
-// registerAllMetrics registers all cache metrics with the provided meter
-func registerAllMetrics(meter metric.Meter) error {
-	// Create observers for all metrics
-	hitObserver, err := meter.Int64ObservableCounter("cache.hit",
-		metric.WithDescription("Number of cache hits"))
-	if err != nil {
-		return err
+// WithDisabledMetrics prevents the metrics with the given unprefixed names, e.g. "cache.collision",
+// from being registered. Unknown metric names are rejected. The recorded metrics, cache.lookup,
+// cache.capacity_utilization, cache.warmup.duration and cache.warmup.size, are disabled by passing it
+// to NewLookupRecorder, StartUtilizationSampler and WarmCache. For the registered metrics,
+// it's taken from the call that registers the metrics, see Option.
+func WithDisabledMetrics(names ...string) Option {
+	return func(c *config) {
+		for _, name := range names {
+			if _, ok := metricDefinitions[name]; !ok {
+				c.setErr(fmt.Errorf("unknown metric '%s'", name))
+				return
+			}
+			if c.disabled == nil {
+				c.disabled = make(map[string]bool)
+			}
+			c.disabled[name] = true
+		}
 	}
+}
 
-	missObserver, err := meter.Int64ObservableCounter("cache.miss",
-		metric.WithDescription("Number of cache misses"))
-	if err != nil {
-		return err
+// WithMetricAlias additionally registers the counter with the unprefixed name canonical, e.g.
+// "cache.hit", under alias, reporting the same values, e.g. while migrating dashboards to new names.
+// The metric prefix applies to the alias too. Every alias doubles the series stored for its counter,
+// so drop it once the migration is done. Only counters can be aliased; other and unknown metric
+// names are rejected, as is an empty alias.
+// It's taken from the call that registers the metrics, see Option.
+func WithMetricAlias(canonical, alias string) Option {
+	return func(c *config) {
+		if _, ok := metricDefinitions[canonical]; !ok {
+			c.setErr(fmt.Errorf("unknown metric '%s'", canonical))
+			return
+		}
+		if !isCounter(canonical) {
+			c.setErr(fmt.Errorf("metric '%s' is not a counter and can't be aliased", canonical))
+			return
+		}
+		if alias == "" {
+			c.setErr(errors.New("metric alias must not be empty"))
+			return
+		}
+		if c.aliases == nil {
+			c.aliases = make(map[string]string)
+		}
+		c.aliases[canonical] = alias
 	}
+}
 
-	insertObserver, err := meter.Int64ObservableCounter("cache.insert",
-		metric.WithDescription("Number of cache inserts"))
-	if err != nil {
-		return err
+// WithNameSanitizer sets the function applied to cache names before they're reported as attribute
+// values, e.g. SanitizeName. Names are reported unchanged by default. Only the attribute value is
+// sanitized: caches are still looked up, e.g. by Snapshot or UninstrumentCache, by the name they were
+// instrumented with. A cache whose sanitized name is already reported for another cache is rejected,
+// as their series would merge.
+func WithNameSanitizer(sanitize func(string) string) Option {
+	return func(c *config) {
+		c.nameSanitizer = sanitize
 	}
+}
 
-	evictionObserver, err := meter.Int64ObservableCounter("cache.eviction",
-		metric.WithDescription("Number of cache evictions"))
-	if err != nil {
-		return err
+// SanitizeName replaces every character of name other than ASCII letters, digits and "_.-:/" with "_",
+// so names taken from user input are accepted by metric backends.
+func SanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("_.-:/", r):
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// WithNameFilter reports only the caches for whose name filter returns true, e.g. to instrument every
+// cache but export the ones of production only. The filter is consulted on every collection with the
+// name the cache was instrumented with. A nil filter reports every cache.
+// It's taken from the call that registers the metrics, see Option.
+func WithNameFilter(filter func(name string) bool) Option {
+	return func(c *config) {
+		c.nameFilter = filter
+	}
+}
+
+// WithLogger sets a logger for diagnostics, e.g. a warning when a counter value is clamped or debug
+// records when metrics are registered and caches are skipped. Nothing is logged by default. The logger
+// used during collection is taken from the call that registers the metrics, see Option.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
 	}
+}
 
-	collisionObserver, err := meter.Int64ObservableCounter("cache.collision",
-		metric.WithDescription("Number of cache collisions"))
-	if err != nil {
-		return err
+// WithSnapshotTTL reuses the metrics read from a cache for d instead of calling Metrics on every
+// collection, reducing lock contention on frequently scraped caches at the cost of staleness.
+// d must be positive. It's taken from the call that registers the metrics, see Option.
+func WithSnapshotTTL(d time.Duration) Option {
+	return func(c *config) {
+		if d <= 0 {
+			c.setErr(fmt.Errorf("snapshot TTL must be positive, got %s", d))
+			return
+		}
+		c.snapshotTTL = d
 	}
+}
 
-	removalObserver, err := meter.Int64ObservableCounter("cache.removal",
-		metric.WithDescription("Number of cache removals"))
-	if err != nil {
-		return err
+// WithObserveTimeout limits the time a cache's Metrics method may take to d per collection, so a
+// cache stuck on its lock can't stall the collection of all caches. Caches not responding in time
+// are skipped and counted in cache.instrument.errors with error.type "timeout"; their Metrics call
+// keeps running in the background, and the cache is skipped without calling Metrics again until it
+// returns. d must be positive. It's taken from the call that registers the metrics, see Option.
+func WithObserveTimeout(d time.Duration) Option {
+	return func(c *config) {
+		if d <= 0 {
+			c.setErr(fmt.Errorf("observe timeout must be positive, got %s", d))
+			return
+		}
+		c.observeTimeout = d
 	}
+}
 
-	// Register single callback that observes all metrics at once
-	_, err = meter.RegisterCallback(
-		func(ctx context.Context, o metric.Observer) error {
-			registry.forEach(func(name string, cache MetricsProvider) {
-				metrics := cache.Metrics()
-				attrs := metric.WithAttributes(attribute.String("cache_name", name))
+// WithBaggageKeys promotes the members of the OTel baggage with the given keys to attributes of the
+// lookups recorded by a LookupRecorder. Members missing from the baggage are left out.
+func WithBaggageKeys(keys ...string) Option {
+	return func(c *config) {
+		c.baggageKeys = append(c.baggageKeys, keys...)
+	}
+}
 
-				o.ObserveInt64(hitObserver, int64(metrics.Hits), attrs)
-				o.ObserveInt64(missObserver, int64(metrics.Misses), attrs)
-				o.ObserveInt64(insertObserver, int64(metrics.Inserts), attrs)
-				o.ObserveInt64(evictionObserver, int64(metrics.Evictions), attrs)
-				o.ObserveInt64(collisionObserver, int64(metrics.Collisions), attrs)
-				o.ObserveInt64(removalObserver, int64(metrics.Removals), attrs)
-			})
-			return nil
-		},
-		hitObserver, missObserver, insertObserver, evictionObserver, collisionObserver, removalObserver,
-	)
+// WithSizeAsUpDownCounter registers cache.size as an Int64ObservableUpDownCounter instead of an
+// Int64ObservableGauge, for backends handling up-down counters better than gauges.
+// It's taken from the call that registers the metrics, see Option.
+func WithSizeAsUpDownCounter() Option {
+	return func(c *config) {
+		c.sizeAsUpDown = true
+	}
+}
+
+// WithSkipZeroValues skips observing counters that are 0, e.g. the evictions of a cache that was never
+// used, so backends don't create series for them. A missing series then means either 0 or a cache that
+// isn't instrumented, and a replaced cache's series disappear until its counters grow again. Gauges are
+// still reported. It's taken from the call that registers the metrics, see Option.
+func WithSkipZeroValues() Option {
+	return func(c *config) {
+		c.skipZero = true
+	}
+}
+
+// WithAggregateMetrics additionally registers counters summing each counter across all instrumented
+// caches, e.g. "cache.total.hit". They carry the attributes set by WithAttributes but no cache name.
+// They are opt-in, as summing the per-cache series and the totals in a query counts twice.
+// It's taken from the call that registers the metrics, see Option.
+//
+// The totals never decrease, as exporters take that for a reset: they keep the last values of caches
+// that were uninstrumented and of counters that started over, e.g. after ReplaceCache.
+func WithAggregateMetrics() Option {
+	return func(c *config) {
+		c.aggregate = true
+	}
+}
+
+// otherCacheName is the cache name of the series collecting the caches beyond the limit of
+// WithAttributeCardinalityLimit
+const otherCacheName = "_other"
+
+// WithAttributeCardinalityLimit limits the number of cache names reported to n, e.g. for caches named
+// after dynamic values. The n caches instrumented first are reported under their own name, while the
+// counters of the others are summed into a single series with the cache name "_other". Their gauges
+// aren't reported. n must be positive.
+// It's taken from the call that registers the metrics, see Option.
+//
+// The "_other" counters never decrease: they keep the last values of caches that left them, either
+// because they were uninstrumented or because they were promoted to their own series after an older
+// cache was uninstrumented. A promoted cache reports all of its counts under its own name, so summing
+// across all cache names counts its earlier counts twice.
+func WithAttributeCardinalityLimit(n int) Option {
+	return func(c *config) {
+		if n <= 0 {
+			c.setErr(fmt.Errorf("attribute cardinality limit must be positive, got %d", n))
+			return
+		}
+		c.cardinality = n
+	}
+}
+
+// WithCardinalityWarn logs a warning with the logger set by WithLogger for every cache instrumented
+// while more than n caches are registered, e.g. to notice caches named after dynamic values. Unlike
+// WithAttributeCardinalityLimit it doesn't change what's reported. n must be positive.
+func WithCardinalityWarn(n int) Option {
+	return func(c *config) {
+		if n <= 0 {
+			c.setErr(fmt.Errorf("cardinality warning threshold must be positive, got %d", n))
+			return
+		}
+		c.cardinalityWarn = n
+	}
+}
+
+// InstrumentCache registers OpenTelemetry Observable Counter metrics of any instance of freelru cache
+// with the default Instrumenter. See Instrumenter.Instrument for details.
+func InstrumentCache(cache MetricsProvider, name string, opts ...Option) error {
+	return defaultInstrumenter.Instrument(cache, name, opts...)
+}
+
+// InstrumentCacheCtx instruments cache under name with the default Instrumenter and uninstruments
+// it once ctx is done. See Instrumenter.InstrumentCtx for details.
+func InstrumentCacheCtx(ctx context.Context, cache MetricsProvider, name string, opts ...Option) error {
+	return defaultInstrumenter.InstrumentCtx(ctx, cache, name, opts...)
+}
+
+// MustInstrumentCache is like InstrumentCache but panics if the cache can't be instrumented.
+// It simplifies wiring in main, where failing fast is preferred over handling the error.
+func MustInstrumentCache(cache MetricsProvider, name string, opts ...Option) {
+	if err := InstrumentCache(cache, name, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// InstrumentCacheNamed instruments cache under the name returned by namer.CacheName()
+// with the default Instrumenter. See Instrumenter.InstrumentCacheNamed for details.
+func InstrumentCacheNamed(cache MetricsProvider, namer Namer, opts ...Option) error {
+	return defaultInstrumenter.InstrumentCacheNamed(cache, namer, opts...)
+}
+
+// InstrumentCacheWithCleanup instruments cache under name with the default Instrumenter and returns
+// a function uninstrumenting it again. See Instrumenter.InstrumentWithCleanup for details.
+func InstrumentCacheWithCleanup(cache MetricsProvider, name string, opts ...Option) (func() error, error) {
+	return defaultInstrumenter.InstrumentWithCleanup(cache, name, opts...)
+}
+
+// InstrumentFunc instruments the metrics returned by fn under name with the default Instrumenter.
+func InstrumentFunc(fn MetricsFunc, name string, opts ...Option) error {
+	return defaultInstrumenter.Instrument(fn, name, opts...)
+}
+
+// InstrumentCaches instruments every cache in caches under its map key with the default Instrumenter,
+// rolling back on the first failure. See Instrumenter.InstrumentAll for details.
+func InstrumentCaches(caches map[string]MetricsProvider, opts ...Option) error {
+	return defaultInstrumenter.InstrumentAll(caches, opts...)
+}
+
+// UninstrumentCache stops reporting metrics for the cache registered under name.
+// It returns an error if no cache with that name is instrumented.
+func UninstrumentCache(name string) error {
+	return defaultInstrumenter.Uninstrument(name)
+}
+
+// Shutdown unregisters the callbacks of the default Instrumenter and removes all instrumented caches.
+// See Instrumenter.Shutdown for details.
+func Shutdown() error {
+	return defaultInstrumenter.Shutdown()
+}
+
+// ReplaceCache swaps the cache registered under name with the default Instrumenter for cache.
+// See Instrumenter.Replace for details.
+func ReplaceCache(name string, cache MetricsProvider) error {
+	return defaultInstrumenter.Replace(name, cache)
+}
+
+// SetEnabled suspends or resumes reporting metrics for the cache registered under name.
+// See Instrumenter.SetEnabled for details.
+func SetEnabled(name string, enabled bool) error {
+	return defaultInstrumenter.SetEnabled(name, enabled)
+}
+
+// RecordPurge counts a purge of the cache registered under name with the default Instrumenter.
+// See Instrumenter.RecordPurge for details.
+func RecordPurge(name string) error {
+	return defaultInstrumenter.RecordPurge(name)
+}
+
+// RecordHit counts a hit of the cache registered under name with the default Instrumenter that the
+// cache itself didn't see. See Instrumenter.RecordHit for details.
+func RecordHit(name string) error {
+	return defaultInstrumenter.RecordHit(name)
+}
+
+// RecordMiss counts a miss of the cache registered under name with the default Instrumenter that the
+// cache itself didn't see. See Instrumenter.RecordMiss for details.
+func RecordMiss(name string) error {
+	return defaultInstrumenter.RecordMiss(name)
+}
+
+// WarmCache runs fn to populate the cache with the given name in a span, recording its duration.
+// See Instrumenter.WarmCache for details.
+func WarmCache(ctx context.Context, name string, fn func() error, opts ...Option) error {
+	return defaultInstrumenter.WarmCache(ctx, name, fn, opts...)
+}
+
+// StartUtilizationSampler starts sampling the fill ratio of the caches instrumented with the
+// default Instrumenter every interval. See Instrumenter.StartUtilizationSampler for details.
+func StartUtilizationSampler(interval time.Duration, opts ...Option) (*UtilizationSampler, error) {
+	return defaultInstrumenter.StartUtilizationSampler(interval, opts...)
+}
+
+// InstrumentedCaches returns the names of all instrumented caches in sorted order.
+func InstrumentedCaches() []string {
+	return defaultInstrumenter.InstrumentedCaches()
+}
+
+// Snapshot returns the current metrics of the cache instrumented under name,
+// and whether such a cache exists.
+func Snapshot(name string) (freelru.Metrics, bool) {
+	return defaultInstrumenter.Snapshot(name)
+}
+
+// Snapshots returns the current metrics of every instrumented cache, keyed by cache name.
+func Snapshots() map[string]freelru.Metrics {
+	return defaultInstrumenter.Snapshots()
+}
+
+// DiffSnapshots returns the change of the metrics of every cache between two results of Snapshots,
+// e.g. the hits gained during a load test, keyed by cache name. Caches only in after, instrumented
+// in between, count from zero, and caches only in before are left out. A counter lower in after than
+// in before, e.g. of a cache swapped by ReplaceCache, started over, so its value in after is the change.
+func DiffSnapshots(before, after map[string]freelru.Metrics) map[string]freelru.Metrics {
+	diff := make(map[string]freelru.Metrics, len(after))
+	for name, a := range after {
+		b := before[name]
+		diff[name] = freelru.Metrics{
+			Inserts:    counterDelta(b.Inserts, a.Inserts),
+			Collisions: counterDelta(b.Collisions, a.Collisions),
+			Evictions:  counterDelta(b.Evictions, a.Evictions),
+			Removals:   counterDelta(b.Removals, a.Removals),
+			Hits:       counterDelta(b.Hits, a.Hits),
+			Misses:     counterDelta(b.Misses, a.Misses),
+		}
+	}
+	return diff
+}
+
+// counterDelta returns the increase of a counter from before to after, treating a decrease as a restart
+func counterDelta(before, after uint64) uint64 {
+	if after < before {
+		return after
+	}
+	return after - before
+}
+
+// AggregateStats returns the totals across every cache instrumented with the default Instrumenter.
+// See Instrumenter.AggregateStats for details.
+func AggregateStats() Stats {
+	return defaultInstrumenter.AggregateStats()
+}
+
+// AggregateByAttribute returns the totals across the caches instrumented with the default Instrumenter,
+// grouped by the value of a WithCacheAttributes attribute. See Instrumenter.AggregateByAttribute for details.
+func AggregateByAttribute(key string) map[string]Stats {
+	return defaultInstrumenter.AggregateByAttribute(key)
+}
+
+// CreatedTimes returns when every instrumented cache was instrumented, keyed by cache name.
+// See Instrumenter.CreatedTimes for details.
+func CreatedTimes() map[string]time.Time {
+	return defaultInstrumenter.CreatedTimes()
+}
+
+// RegisteredInstruments returns the counters registered with provider by the default Instrumenter.
+// See Instrumenter.RegisteredInstruments for details.
+func RegisteredInstruments(provider metric.MeterProvider, opts ...Option) map[string]metric.Int64ObservableCounter {
+	return defaultInstrumenter.RegisteredInstruments(provider, opts...)
+}
 
-	return err
+// MetricsRegistered reports whether the default Instrumenter registered its metrics with any meter.
+// See Instrumenter.MetricsRegistered for details.
+func MetricsRegistered() bool {
+	return defaultInstrumenter.MetricsRegistered()
 }
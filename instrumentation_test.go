@@ -2,11 +2,19 @@ package freelruotel
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
@@ -107,6 +115,13 @@ func TestInstrumentCache(t *testing.T) {
 	}
 }
 
+// exerciseCache adds key to the cache, then generates one hit and one miss
+func exerciseCache[K comparable, V any](cache freelru.Cache[K, V], key K, value V, missing K) {
+	cache.Add(key, value)
+	cache.Get(key)     // hit
+	cache.Get(missing) // miss
+}
+
 func mustCreateShardedCache() *freelru.ShardedLRU[string, string] {
 	cache, err := freelru.NewSharded[string, string](10, hashStringXXHASH)
 	if err != nil {
@@ -367,3 +382,3174 @@ func TestInstrumentCacheDuplicateName(t *testing.T) {
 		t.Errorf("Expected error message '%s', got '%s'", expectedError, err.Error())
 	}
 }
+
+func TestInstrumentCacheDuplicateNameKeepsOriginal(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	original := mustCreateLRUCache()
+	duplicate := mustCreateLRUCache()
+
+	err := InstrumentCache(original, "duplicate_name", WithMeterProvider(provider))
+	if err != nil {
+		t.Fatalf("First cache should not fail: %v", err)
+	}
+
+	err = InstrumentCache(duplicate, "duplicate_name", WithMeterProvider(provider))
+	if err == nil {
+		t.Fatal("Expected error when adding cache with duplicate name")
+	}
+
+	// Generate a single hit on the original and several on the duplicate,
+	// so the observed value tells us which instance is registered
+	original.Add("key", "value")
+	original.Get("key")
+
+	duplicate.Add("key", "value")
+	duplicate.Get("key")
+	duplicate.Get("key")
+	duplicate.Get("key")
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "duplicate_name")
+	if !ok {
+		t.Fatal("No data point found for duplicate_name")
+	}
+	if dp.Value != 1 {
+		t.Errorf("Expected hits of the original cache (1), got %d", dp.Value)
+	}
+}
+
+// collectMetrics collects all metrics from the reader, failing the test on error
+func collectMetrics(t *testing.T, reader metric.Reader) *metricdata.ResourceMetrics {
+	t.Helper()
+
+	rm := &metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	return rm
+}
+
+// findMetric returns the metric with the given name from any scope, or nil if absent
+func findMetric(rm *metricdata.ResourceMetrics, name string) *metricdata.Metrics {
+	for i := range rm.ScopeMetrics {
+		for j := range rm.ScopeMetrics[i].Metrics {
+			if rm.ScopeMetrics[i].Metrics[j].Name == name {
+				return &rm.ScopeMetrics[i].Metrics[j]
+			}
+		}
+	}
+	return nil
+}
+
+// findDataPoint returns the data point carrying the given cache_name attribute
+func findDataPoint[N int64 | float64](dps []metricdata.DataPoint[N], cacheName string) (metricdata.DataPoint[N], bool) {
+	for _, dp := range dps {
+		if v, ok := dp.Attributes.Value("cache_name"); ok && v.AsString() == cacheName {
+			return dp, true
+		}
+	}
+	return metricdata.DataPoint[N]{}, false
+}
+
+// metricsOnlyCache implements MetricsProvider without any of the optional interfaces
+type metricsOnlyCache struct {
+	metrics freelru.Metrics
+}
+
+func (c *metricsOnlyCache) Metrics() freelru.Metrics {
+	return c.metrics
+}
+
+func TestInstrumentCacheSize(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateSyncedCache()
+	if err := InstrumentCache(cache, "sized", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(&metricsOnlyCache{}, "unsized", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	cache.Add("key1", "value1")
+	cache.Add("key2", "value2")
+	cache.Add("key3", "value3")
+	cache.Remove("key2")
+
+	rm := collectMetrics(t, reader)
+
+	sizeMetric := findMetric(rm, "cache.size")
+	if sizeMetric == nil {
+		t.Fatal("cache.size metric not found")
+	}
+
+	gauge, ok := sizeMetric.Data.(metricdata.Gauge[int64])
+	if !ok {
+		t.Fatalf("Expected cache.size to be an int64 gauge, got %T", sizeMetric.Data)
+	}
+
+	dp, ok := findDataPoint(gauge.DataPoints, "sized")
+	if !ok {
+		t.Fatal("No cache.size data point found for sized cache")
+	}
+	if dp.Value != 2 {
+		t.Errorf("Expected cache.size 2, got %d", dp.Value)
+	}
+
+	if _, ok := findDataPoint(gauge.DataPoints, "unsized"); ok {
+		t.Error("Expected no cache.size data point for a cache without Len()")
+	}
+}
+
+// cappedCache wraps a freelru cache to report its configured capacity
+type cappedCache struct {
+	*freelru.ShardedLRU[string, string]
+	capacity int
+}
+
+func (c cappedCache) Cap() int {
+	return c.capacity
+}
+
+// uncappedCache wraps a freelru cache to hide its capacity, reporting its size only
+type uncappedCache struct {
+	*freelru.LRU[string, string]
+}
+
+func TestInstrumentCacheCapacity(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// 4 shards of ceil(10/4) entries each round the capacity up to 12
+	sharded, err := freelru.NewShardedWithSize[string, string](4, 10, 1024, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	caches := []struct {
+		name     string
+		cache    MetricsProvider
+		capacity int64
+	}{
+		{name: "lru", cache: mustCreateLRUCache(), capacity: 10},
+		{name: "synced", cache: mustCreateSyncedCache(), capacity: 10},
+		{name: "sharded", cache: sharded, capacity: 12},
+		// Cap takes precedence over the detected capacity
+		{name: "capped", cache: cappedCache{sharded, 7}, capacity: 7},
+	}
+	for _, c := range caches {
+		if err := InstrumentCache(c.cache, c.name, WithMeterProvider(provider)); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", c.name, err)
+		}
+	}
+	if err := InstrumentCache(uncappedCache{mustCreateLRUCache()}, "uncapped", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	capacityMetric := findMetric(rm, "cache.capacity")
+	if capacityMetric == nil {
+		t.Fatal("cache.capacity metric not found")
+	}
+
+	gauge := capacityMetric.Data.(metricdata.Gauge[int64])
+	for _, c := range caches {
+		dp, ok := findDataPoint(gauge.DataPoints, c.name)
+		if !ok {
+			t.Errorf("No cache.capacity data point found for %s", c.name)
+			continue
+		}
+		if dp.Value != c.capacity {
+			t.Errorf("Cache %s: expected cache.capacity %d, got %d", c.name, c.capacity, dp.Value)
+		}
+	}
+
+	if _, ok := findDataPoint(gauge.DataPoints, "uncapped"); ok {
+		t.Error("Expected no cache.capacity data point for a cache without Cap()")
+	}
+}
+
+func TestInstrumentCacheWithAttributes(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	attrs := []attribute.KeyValue{
+		attribute.String("region", "eu-west-1"),
+		attribute.String("service", "checkout"),
+		attribute.String("cache_name", "overridden"),
+	}
+	original := append([]attribute.KeyValue(nil), attrs...)
+
+	err := InstrumentCache(mustCreateLRUCache(), "attributed",
+		WithMeterProvider(provider), WithAttributes(attrs...))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	for i := range attrs {
+		if attrs[i] != original[i] {
+			t.Errorf("Caller's attribute slice was mutated at index %d", i)
+		}
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "attributed")
+	if !ok {
+		t.Fatal("No data point found with the original cache_name")
+	}
+
+	for _, want := range attrs[:2] {
+		got, ok := dp.Attributes.Value(want.Key)
+		if !ok || got != want.Value {
+			t.Errorf("Expected attribute %s=%s, got %v", want.Key, want.Value.Emit(), got.Emit())
+		}
+	}
+}
+
+func TestInstrumentCacheWithCacheAttributes(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "sessions",
+		WithMeterProvider(provider),
+		WithAttributes(attribute.String("service", "checkout")),
+		WithCacheAttributes(attribute.String("team", "identity")))
+	if err != nil {
+		t.Fatalf("Failed to instrument sessions: %v", err)
+	}
+
+	err = InstrumentCache(mustCreateSyncedCache(), "products",
+		WithMeterProvider(provider),
+		WithCacheAttributes(attribute.String("team", "catalog")))
+	if err != nil {
+		t.Fatalf("Failed to instrument products: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+	expectedTeams := map[string]string{
+		"sessions": "identity",
+		"products": "catalog",
+	}
+	for cacheName, team := range expectedTeams {
+		dp, ok := findDataPoint(dps, cacheName)
+		if !ok {
+			t.Errorf("No data point found for %s", cacheName)
+			continue
+		}
+		if got, _ := dp.Attributes.Value("team"); got.AsString() != team {
+			t.Errorf("Cache %s: expected team %s, got %s", cacheName, team, got.AsString())
+		}
+		// Global attributes are taken from the call that registers the metrics and apply to every cache
+		if got, _ := dp.Attributes.Value("service"); got.AsString() != "checkout" {
+			t.Errorf("Cache %s: expected service checkout, got %s", cacheName, got.AsString())
+		}
+	}
+}
+
+func TestUninstrumentCache(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	if err := InstrumentCache(mustCreateLRUCache(), "kept", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument kept: %v", err)
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "removed", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument removed: %v", err)
+	}
+
+	if err := UninstrumentCache("removed"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+	if len(dps) != 1 {
+		t.Fatalf("Expected 1 data point, got %d", len(dps))
+	}
+	if _, ok := findDataPoint(dps, "kept"); !ok {
+		t.Error("Expected data point for kept cache")
+	}
+
+	err := UninstrumentCache("removed")
+	if err == nil {
+		t.Fatal("Expected error when uninstrumenting an unknown cache")
+	}
+
+	expectedError := "cache with name 'removed' does not exist"
+	if err.Error() != expectedError {
+		t.Errorf("Expected error message '%s', got '%s'", expectedError, err.Error())
+	}
+}
+
+func TestInstrumentCacheAfterUninstrument(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	first := mustCreateLRUCache()
+	first.Add("key", "value")
+	first.Get("key")
+	if err := InstrumentCache(first, "a", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument first cache: %v", err)
+	}
+	if err := RecordMiss("a"); err != nil {
+		t.Fatalf("Failed to record miss: %v", err)
+	}
+	collectMetrics(t, reader)
+
+	if err := UninstrumentCache("a"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+
+	second := mustCreateLRUCache()
+	for i := 0; i < 3; i++ {
+		second.Add(fmt.Sprintf("key%d", i), "value")
+		second.Get(fmt.Sprintf("key%d", i))
+	}
+	if err := InstrumentCache(second, "a", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to reuse the name of an uninstrumented cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	for name, want := range map[string]int64{"cache.hit": 3, "cache.miss": 0} {
+		m := findMetric(rm, name)
+		if m == nil {
+			t.Fatalf("%s metric not found", name)
+		}
+		dps := m.Data.(metricdata.Sum[int64]).DataPoints
+		if len(dps) != 1 {
+			t.Fatalf("Expected 1 %s data point, got %d", name, len(dps))
+		}
+		if dps[0].Value != want {
+			t.Errorf("Expected %s of the new instance to be %d, got %d", name, want, dps[0].Value)
+		}
+	}
+}
+
+func TestInstrumentCacheMultipleProviders(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	readerA := metric.NewManualReader()
+	providerA := metric.NewMeterProvider(metric.WithReader(readerA))
+
+	readerB := metric.NewManualReader()
+	providerB := metric.NewMeterProvider(metric.WithReader(readerB))
+
+	if err := InstrumentCache(mustCreateLRUCache(), "cache1", WithMeterProvider(providerA)); err != nil {
+		t.Fatalf("Failed to instrument cache1: %v", err)
+	}
+	if err := InstrumentCache(mustCreateSyncedCache(), "cache2", WithMeterProvider(providerB)); err != nil {
+		t.Fatalf("Failed to instrument cache2: %v", err)
+	}
+
+	// Both providers observe the shared registry
+	for readerName, reader := range map[string]metric.Reader{"A": readerA, "B": readerB} {
+		rm := collectMetrics(t, reader)
+
+		hitMetric := findMetric(rm, "cache.hit")
+		if hitMetric == nil {
+			t.Fatalf("Reader %s: cache.hit metric not found", readerName)
+		}
+		dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+		for _, cacheName := range []string{"cache1", "cache2"} {
+			if _, ok := findDataPoint(dps, cacheName); !ok {
+				t.Errorf("Reader %s: expected data point for %s", readerName, cacheName)
+			}
+		}
+	}
+}
+
+func TestInstrumentCacheHitRatio(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "ratio", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "idle", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	cache.Add("key", "value")
+	cache.Get("key")  // hit
+	cache.Get("miss") // miss
+
+	rm := collectMetrics(t, reader)
+
+	ratioMetric := findMetric(rm, "cache.hit_ratio")
+	if ratioMetric == nil {
+		t.Fatal("cache.hit_ratio metric not found")
+	}
+	gauge := ratioMetric.Data.(metricdata.Gauge[float64])
+
+	expectedRatios := map[string]float64{
+		"ratio": 0.5,
+		"idle":  0,
+	}
+	for cacheName, expected := range expectedRatios {
+		dp, ok := findDataPoint(gauge.DataPoints, cacheName)
+		if !ok {
+			t.Errorf("No cache.hit_ratio data point found for %s", cacheName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("Cache %s: expected hit ratio %v, got %v", cacheName, expected, dp.Value)
+		}
+	}
+}
+
+func TestInstrumentCacheCollisionRate(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	caches := map[string]MetricsProvider{
+		"colliding": &metricsOnlyCache{metrics: freelru.Metrics{Inserts: 12, Collisions: 3}},
+		"empty":     &metricsOnlyCache{},
+	}
+	if err := InstrumentCaches(caches, WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	rateMetric := findMetric(rm, "cache.collision_rate")
+	if rateMetric == nil {
+		t.Fatal("cache.collision_rate metric not found")
+	}
+	gauge := rateMetric.Data.(metricdata.Gauge[float64])
+
+	expectedRates := map[string]float64{
+		"colliding": 0.25,
+		"empty":     0,
+	}
+	for cacheName, expected := range expectedRates {
+		dp, ok := findDataPoint(gauge.DataPoints, cacheName)
+		if !ok {
+			t.Errorf("No cache.collision_rate data point found for %s", cacheName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("Cache %s: expected collision rate %v, got %v", cacheName, expected, dp.Value)
+		}
+	}
+}
+
+func TestInstrumentCacheNetEntries(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	caches := map[string]MetricsProvider{
+		"growing": &metricsOnlyCache{metrics: freelru.Metrics{Inserts: 10, Removals: 3, Evictions: 2}},
+		// More removed than inserted, as other sources may report
+		"negative": &metricsOnlyCache{metrics: freelru.Metrics{Inserts: 1, Removals: 4}},
+	}
+	if err := InstrumentCaches(caches, WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	netMetric := findMetric(rm, "cache.net_entries")
+	if netMetric == nil {
+		t.Fatal("cache.net_entries metric not found")
+	}
+	gauge := netMetric.Data.(metricdata.Gauge[int64])
+
+	expectedValues := map[string]int64{
+		"growing":  5,
+		"negative": 0,
+	}
+	for cacheName, expected := range expectedValues {
+		dp, ok := findDataPoint(gauge.DataPoints, cacheName)
+		if !ok {
+			t.Errorf("No cache.net_entries data point found for %s", cacheName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("Cache %s: expected %d net entries, got %d", cacheName, expected, dp.Value)
+		}
+	}
+}
+
+func TestInstrumentCacheWithCollisionMetricName(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := &metricsOnlyCache{metrics: freelru.Metrics{Collisions: 2}}
+	err := InstrumentCache(cache, "renamed", WithMeterProvider(provider),
+		WithMetricPrefix("checkout"), WithCollisionMetricName("cache.hash_collision"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	if findMetric(rm, "checkout.cache.collision") != nil {
+		t.Error("Expected cache.collision not to be registered under its default name")
+	}
+	collisionMetric := findMetric(rm, "checkout.cache.hash_collision")
+	if collisionMetric == nil {
+		t.Fatal("checkout.cache.hash_collision metric not found")
+	}
+	dp, ok := findDataPoint(collisionMetric.Data.(metricdata.Sum[int64]).DataPoints, "renamed")
+	if !ok {
+		t.Fatal("No data point found for renamed cache")
+	}
+	if dp.Value != 2 {
+		t.Errorf("Expected 2 collisions, got %d", dp.Value)
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithCollisionMetricName("")); err == nil {
+		t.Error("Expected an error for an empty collision metric name")
+	}
+}
+
+func TestInstrumentCacheWithAttributeCardinalityLimit(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// The caches are instrumented in order, so the last one is beyond the limit
+	caches := []struct {
+		name string
+		hits uint64
+	}{
+		{name: "first", hits: 1},
+		{name: "second", hits: 2},
+		{name: "third", hits: 4},
+	}
+	for _, c := range caches {
+		cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: c.hits}}
+		err := InstrumentCache(cache, c.name, WithMeterProvider(provider), WithAttributeCardinalityLimit(2))
+		if err != nil {
+			t.Fatalf("Failed to instrument %s: %v", c.name, err)
+		}
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+	expectedHits := map[string]int64{
+		"first":  1,
+		"second": 2,
+		"_other": 4,
+	}
+	if len(dps) != len(expectedHits) {
+		t.Errorf("Expected %d data points, got %d", len(expectedHits), len(dps))
+	}
+	for cacheName, expected := range expectedHits {
+		dp, ok := findDataPoint(dps, cacheName)
+		if !ok {
+			t.Errorf("No data point found for %s", cacheName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("Cache %s: expected %d hits, got %d", cacheName, expected, dp.Value)
+		}
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithAttributeCardinalityLimit(0)); err == nil {
+		t.Error("Expected an error for a non-positive cardinality limit")
+	}
+}
+
+func TestAttributeCardinalityLimitOtherStaysMonotonic(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// The caches are instrumented in order, so the last two are beyond the limit
+	for _, c := range []struct {
+		name string
+		hits uint64
+	}{
+		{name: "first", hits: 1},
+		{name: "second", hits: 2},
+		{name: "third", hits: 4},
+	} {
+		cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: c.hits}}
+		err := InstrumentCache(cache, c.name, WithMeterProvider(provider), WithAttributeCardinalityLimit(1))
+		if err != nil {
+			t.Fatalf("Failed to instrument %s: %v", c.name, err)
+		}
+	}
+
+	hits := func() map[string]int64 {
+		t.Helper()
+		hitMetric := findMetric(collectMetrics(t, reader), "cache.hit")
+		if hitMetric == nil {
+			t.Fatal("cache.hit metric not found")
+		}
+		got := make(map[string]int64)
+		for _, dp := range hitMetric.Data.(metricdata.Sum[int64]).DataPoints {
+			name, _ := dp.Attributes.Value("cache_name")
+			got[name.AsString()] = dp.Value
+		}
+		return got
+	}
+	if got := hits(); got["first"] != 1 || got["_other"] != 6 {
+		t.Fatalf("Expected 1 hit for first and 6 for _other, got %v", got)
+	}
+
+	// Removing first promotes second out of "_other", which keeps its hits nonetheless
+	if err := UninstrumentCache("first"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+	got := hits()
+	if got["second"] != 2 {
+		t.Errorf("Expected 2 hits for the promoted cache, got %d", got["second"])
+	}
+	if got["_other"] != 6 {
+		t.Errorf("Expected _other to keep its 6 hits after the promotion, got %d", got["_other"])
+	}
+
+	// As does removing the remaining cache in "_other"
+	if err := UninstrumentCache("third"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+	if got := hits(); got["_other"] != 6 {
+		t.Errorf("Expected _other to keep its 6 hits once its caches are gone, got %d", got["_other"])
+	}
+}
+
+func TestInstrumentCacheWithMetricAlias(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: 7}}
+	err := InstrumentCache(cache, "aliased", WithMeterProvider(provider),
+		WithMetricAlias("cache.hit", "cache.lookup.hit"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	for _, metricName := range []string{"cache.hit", "cache.lookup.hit"} {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Errorf("%s metric not found", metricName)
+			continue
+		}
+		dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "aliased")
+		if !ok {
+			t.Errorf("No %s data point found", metricName)
+			continue
+		}
+		if dp.Value != 7 {
+			t.Errorf("%s: expected 7, got %d", metricName, dp.Value)
+		}
+	}
+
+	invalid := map[string]Option{
+		"unknown metric": WithMetricAlias("cache.unknown", "alias"),
+		"gauge":          WithMetricAlias("cache.size", "alias"),
+		"empty alias":    WithMetricAlias("cache.hit", ""),
+	}
+	for name, opt := range invalid {
+		if err := InstrumentCache(mustCreateLRUCache(), "invalid", opt); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInstrumentCacheWithNameFilter(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	prodOnly := WithNameFilter(func(name string) bool { return strings.HasPrefix(name, "prod-") })
+	for _, name := range []string{"prod-a", "dev-b"} {
+		if err := InstrumentCache(mustCreateLRUCache(), name, WithMeterProvider(provider), prodOnly); err != nil {
+			t.Fatalf("Failed to instrument %s: %v", name, err)
+		}
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if len(dps) != 1 {
+		t.Errorf("Expected 1 data point, got %d", len(dps))
+	}
+	if _, ok := findDataPoint(dps, "prod-a"); !ok {
+		t.Error("Expected a data point for prod-a")
+	}
+	if _, ok := findDataPoint(dps, "dev-b"); ok {
+		t.Error("Expected no data point for dev-b")
+	}
+
+	// Filtered caches stay instrumented
+	if names := InstrumentedCaches(); len(names) != 2 {
+		t.Errorf("Expected 2 instrumented caches, got %v", names)
+	}
+}
+
+func TestInstrumentCacheWithDynamicAttributes(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	var role string
+	dynamic := WithDynamicAttributes(func() []attribute.KeyValue {
+		if role == "" {
+			return nil
+		}
+		return []attribute.KeyValue{attribute.String("role", role)}
+	})
+	if err := InstrumentCache(mustCreateLRUCache(), "dynamic", WithMeterProvider(provider), dynamic); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	for _, current := range []string{"", "leader", "follower"} {
+		role = current
+		rm := collectMetrics(t, reader)
+
+		hitMetric := findMetric(rm, "cache.hit")
+		if hitMetric == nil {
+			t.Fatal("cache.hit metric not found")
+		}
+		dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+		if len(dps) != 1 {
+			t.Fatalf("Role %q: expected 1 data point, got %d", current, len(dps))
+		}
+		got, ok := dps[0].Attributes.Value("role")
+		if current == "" {
+			if ok {
+				t.Errorf("Expected no role attribute, got %s", got.AsString())
+			}
+			continue
+		}
+		if got.AsString() != current {
+			t.Errorf("Expected role %s, got %s", current, got.AsString())
+		}
+		if name, _ := dps[0].Attributes.Value(defaultCacheNameKey); name.AsString() != "dynamic" {
+			t.Errorf("Expected cache name dynamic, got %s", name.AsString())
+		}
+	}
+}
+
+func BenchmarkCollect(b *testing.B) {
+	for _, numCaches := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("caches=%d", numCaches), func(b *testing.B) {
+			// Reset global state for benchmark isolation
+			resetForTesting()
+
+			reader := metric.NewManualReader()
+			provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+			for i := 0; i < numCaches; i++ {
+				cache := mustCreateSyncedCache()
+				cache.Add("key", "value")
+				cache.Get("key")
+
+				if err := InstrumentCache(cache, fmt.Sprintf("cache_%d", i), WithMeterProvider(provider)); err != nil {
+					b.Fatalf("Failed to instrument cache: %v", err)
+				}
+			}
+
+			rm := &metricdata.ResourceMetrics{}
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := reader.Collect(ctx, rm); err != nil {
+					b.Fatalf("Failed to collect metrics: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestInstrumentCacheWithMetricPrefix(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+	}{
+		{name: "plain", prefix: "checkout"},
+		{name: "trailing separator", prefix: "checkout."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reset global state for test isolation
+			resetForTesting()
+
+			// Create manual reader to collect metrics
+			reader := metric.NewManualReader()
+			provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+			err := InstrumentCache(mustCreateLRUCache(), "prefixed",
+				WithMeterProvider(provider), WithMetricPrefix(tc.prefix))
+			if err != nil {
+				t.Fatalf("Failed to instrument cache: %v", err)
+			}
+
+			rm := collectMetrics(t, reader)
+
+			if findMetric(rm, "checkout.cache.hit") == nil {
+				t.Error("checkout.cache.hit metric not found")
+			}
+			if findMetric(rm, "cache.hit") != nil {
+				t.Error("Expected no unprefixed cache.hit metric")
+			}
+		})
+	}
+}
+
+func TestInstrumentCacheWithEmptyMetricPrefix(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	err := InstrumentCache(mustCreateLRUCache(), "prefixed", WithMetricPrefix(""))
+	if err == nil {
+		t.Fatal("Expected error for an empty metric prefix")
+	}
+
+	// The cache must not be registered when options are invalid
+	if err := InstrumentCache(mustCreateLRUCache(), "prefixed"); err != nil {
+		t.Errorf("Expected name to be available after a failed call, got: %v", err)
+	}
+}
+
+func TestInstrumentCacheWithMetricSeparator(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{name: "with prefix", opts: []Option{WithMetricPrefix("app"), WithMetricSeparator("_")}, expected: "app_cache_hit"},
+		{name: "without prefix", opts: []Option{WithMetricSeparator("_")}, expected: "cache_hit"},
+		{name: "dotted prefix", opts: []Option{WithMetricSeparator("-"), WithMetricPrefix("app.checkout")}, expected: "app-checkout-cache-hit"},
+		{name: "default", opts: []Option{WithMetricPrefix("app"), WithMetricSeparator(".")}, expected: "app.cache.hit"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reset global state for test isolation
+			resetForTesting()
+
+			// Create manual reader to collect metrics
+			reader := metric.NewManualReader()
+			provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+			err := InstrumentCache(mustCreateLRUCache(), "separated",
+				append([]Option{WithMeterProvider(provider)}, tc.opts...)...)
+			if err != nil {
+				t.Fatalf("Failed to instrument cache: %v", err)
+			}
+
+			rm := collectMetrics(t, reader)
+			if findMetric(rm, tc.expected) == nil {
+				t.Errorf("%s metric not found", tc.expected)
+			}
+		})
+	}
+
+	for _, sep := range []string{"", "::", " ", "a"} {
+		if err := New().Instrument(mustCreateLRUCache(), "invalid", WithMetricSeparator(sep)); err == nil {
+			t.Errorf("Expected error for separator %q", sep)
+		}
+	}
+}
+
+func TestInstrumentCacheWithCacheNameKey(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "keyed",
+		WithMeterProvider(provider),
+		WithCacheNameKey("cache"),
+		WithAttributes(attribute.String("cache", "overridden")))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if len(dps) != 1 {
+		t.Fatalf("Expected 1 data point, got %d", len(dps))
+	}
+
+	if got, ok := dps[0].Attributes.Value("cache"); !ok || got.AsString() != "keyed" {
+		t.Errorf("Expected attribute cache=keyed, got %v", got.Emit())
+	}
+	if _, ok := dps[0].Attributes.Value("cache_name"); ok {
+		t.Error("Expected no cache_name attribute")
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithCacheNameKey("")); err == nil {
+		t.Error("Expected error for an empty cache name key")
+	}
+}
+
+// session is a non-trivial value type used to check generic cache instantiations
+type session struct {
+	userID uint64
+}
+
+func hashUint64(k uint64) uint32 {
+	return uint32(k ^ (k >> 32))
+}
+
+func hashInt(k int) uint32 {
+	return hashUint64(uint64(k))
+}
+
+func TestInstrumentCacheGenericTypes(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cache MetricsProvider
+	}{
+		{
+			name: "LRU[uint64, *session]",
+			cache: func() MetricsProvider {
+				cache, err := freelru.New[uint64, *session](10, hashUint64)
+				if err != nil {
+					panic(err)
+				}
+				return cache
+			}(),
+		},
+		{
+			name: "SyncedLRU[int, *session]",
+			cache: func() MetricsProvider {
+				cache, err := freelru.NewSynced[int, *session](10, hashInt)
+				if err != nil {
+					panic(err)
+				}
+				return cache
+			}(),
+		},
+		{
+			name: "ShardedLRU[int, struct]",
+			cache: func() MetricsProvider {
+				cache, err := freelru.NewSharded[int, session](10, hashInt)
+				if err != nil {
+					panic(err)
+				}
+				return cache
+			}(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reset global state for test isolation
+			resetForTesting()
+
+			// Create manual reader to collect metrics
+			reader := metric.NewManualReader()
+			provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+			if err := InstrumentCache(tc.cache, "generic", WithMeterProvider(provider)); err != nil {
+				t.Fatalf("Failed to instrument cache: %v", err)
+			}
+
+			switch cache := tc.cache.(type) {
+			case freelru.Cache[uint64, *session]:
+				exerciseCache(cache, 1, &session{userID: 1}, 2)
+			case freelru.Cache[int, *session]:
+				exerciseCache(cache, 1, &session{userID: 1}, 2)
+			case freelru.Cache[int, session]:
+				exerciseCache(cache, 1, session{userID: 1}, 2)
+			default:
+				t.Fatalf("Unexpected cache type %T", tc.cache)
+			}
+
+			rm := collectMetrics(t, reader)
+
+			for metricName, expected := range map[string]int64{"cache.hit": 1, "cache.miss": 1} {
+				m := findMetric(rm, metricName)
+				if m == nil {
+					t.Fatalf("%s metric not found", metricName)
+				}
+				dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "generic")
+				if !ok {
+					t.Fatalf("No %s data point found", metricName)
+				}
+				if dp.Value != expected {
+					t.Errorf("Expected %s %d, got %d", metricName, expected, dp.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestInstrumentCacheUnits(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "units",
+		WithMeterProvider(provider), WithUnit("cache.miss", "1"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	expectedUnits := map[string]string{
+		"cache.hit":       "{hit}",
+		"cache.miss":      "1",
+		"cache.size":      "{entry}",
+		"cache.hit_ratio": "1",
+	}
+	for metricName, unit := range expectedUnits {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Errorf("%s metric not found", metricName)
+			continue
+		}
+		if m.Unit != unit {
+			t.Errorf("Metric %s: expected unit %s, got %s", metricName, unit, m.Unit)
+		}
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithUnit("cache.unknown", "1")); err == nil {
+		t.Error("Expected error for an unknown metric name")
+	}
+}
+
+func TestInstrumentCacheWithDisabledMetrics(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "selective",
+		WithMeterProvider(provider), WithDisabledMetrics("cache.collision", "cache.removal"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	var counters []string
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if _, ok := m.Data.(metricdata.Sum[int64]); ok {
+			counters = append(counters, m.Name)
+		}
+	}
+	if len(counters) != 6 {
+		t.Errorf("Expected 6 counters, got %d: %v", len(counters), counters)
+	}
+
+	for _, disabled := range []string{"cache.collision", "cache.removal"} {
+		if findMetric(rm, disabled) != nil {
+			t.Errorf("Expected disabled metric %s not to be exported", disabled)
+		}
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithDisabledMetrics("cache.unknown")); err == nil {
+		t.Error("Expected error for an unknown metric name")
+	}
+}
+
+func TestRegisteredInstruments(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	provider := metric.NewMeterProvider(metric.WithReader(metric.NewManualReader()))
+
+	if instruments := RegisteredInstruments(provider); instruments != nil {
+		t.Errorf("Expected no instruments before instrumenting, got %v", instruments)
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "instruments", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	instruments := RegisteredInstruments(provider)
+
+	expectedMetrics := []string{"cache.hit", "cache.miss", "cache.insert", "cache.eviction", "cache.collision", "cache.removal"}
+	if len(instruments) != len(expectedMetrics) {
+		t.Errorf("Expected %d instruments, got %d", len(expectedMetrics), len(instruments))
+	}
+	for _, expectedMetric := range expectedMetrics {
+		if instruments[expectedMetric] == nil {
+			t.Errorf("Expected instrument %s not found", expectedMetric)
+		}
+	}
+}
+
+func TestRegisteredInstrumentsWithMeter(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	provider := metric.NewMeterProvider(metric.WithReader(metric.NewManualReader()))
+	meter := provider.Meter("example.com/custom")
+
+	if err := InstrumentCache(mustCreateLRUCache(), "custom_meter", WithMeter(meter)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	if instruments := RegisteredInstruments(provider); instruments != nil {
+		t.Errorf("Expected no instruments for the default scope, got %v", instruments)
+	}
+	instruments := RegisteredInstruments(provider, WithMeter(meter))
+	if instruments["cache.hit"] == nil {
+		t.Errorf("Expected the counters registered with WithMeter, got %v", instruments)
+	}
+	if RegisteredInstruments(nil, WithMeter(meter)) == nil {
+		t.Error("Expected WithMeter to take precedence over a nil provider")
+	}
+}
+
+func TestInstrumentCachesRollback(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	if err := InstrumentCache(mustCreateLRUCache(), "existing", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument existing cache: %v", err)
+	}
+
+	err := InstrumentCaches(map[string]MetricsProvider{
+		"batch_a":  mustCreateLRUCache(),
+		"batch_b":  mustCreateSyncedCache(),
+		"existing": mustCreateShardedCache(),
+		"zbatch_c": mustCreateLRUCache(),
+	}, WithMeterProvider(provider))
+	if err == nil {
+		t.Fatal("Expected error when a batch name collides")
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+	if len(dps) != 1 {
+		t.Errorf("Expected only the existing cache to remain, got %d data points", len(dps))
+	}
+	if _, ok := findDataPoint(dps, "existing"); !ok {
+		t.Error("Expected the existing cache to stay instrumented")
+	}
+
+	// A batch without collisions registers every cache
+	err = InstrumentCaches(map[string]MetricsProvider{
+		"batch_a": mustCreateLRUCache(),
+		"batch_b": mustCreateSyncedCache(),
+	}, WithMeterProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to instrument batch: %v", err)
+	}
+}
+
+// failingMeter is a metric.Meter failing to create observable counters
+type failingMeter struct {
+	noop.Meter
+}
+
+func (failingMeter) Int64ObservableCounter(string, ...otelmetric.Int64ObservableCounterOption) (otelmetric.Int64ObservableCounter, error) {
+	return nil, errors.New("counter rejected")
+}
+
+func TestInstrumentCachesRollbackOnRegistrationError(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	err := InstrumentCaches(map[string]MetricsProvider{
+		"batch_a": mustCreateLRUCache(),
+		"batch_b": mustCreateSyncedCache(),
+	}, WithMeter(failingMeter{}))
+	if err == nil {
+		t.Fatal("Expected error when the metrics can't be registered")
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "single", WithMeter(failingMeter{})); err == nil {
+		t.Fatal("Expected error when the metrics can't be registered")
+	}
+
+	if names := InstrumentedCaches(); len(names) != 0 {
+		t.Errorf("Expected failed calls to leave no cache registered, got %v", names)
+	}
+
+	// The names are free for caches whose metrics can be registered
+	for _, name := range []string{"batch_a", "batch_b", "single"} {
+		if err := InstrumentCache(mustCreateLRUCache(), name); err != nil {
+			t.Errorf("Expected %s to be free after the failed calls, got: %v", name, err)
+		}
+	}
+}
+
+func TestInstrumentCachesRollbackKeepsReusedName(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Between the batch adding batch_a and failing on batch_b, another caller swaps the cache
+	// instrumented under batch_a for its own
+	other := mustCreateLRUCache()
+	var calls int
+	swapThenFail := func(c *config) {
+		calls++
+		if calls != 2 {
+			return
+		}
+		if err := UninstrumentCache("batch_a"); err != nil {
+			t.Errorf("Failed to uninstrument cache: %v", err)
+		}
+		if err := InstrumentCache(other, "batch_a"); err != nil {
+			t.Errorf("Failed to instrument cache: %v", err)
+		}
+		c.setErr(errors.New("batch_b rejected"))
+	}
+
+	err := InstrumentCaches(map[string]MetricsProvider{
+		"batch_a": mustCreateLRUCache(),
+		"batch_b": mustCreateSyncedCache(),
+	}, swapThenFail)
+	if err == nil {
+		t.Fatal("Expected error for the rejected cache")
+	}
+
+	entry, ok := defaultInstrumenter.registry.get("batch_a")
+	if !ok || entry.cache != MetricsProvider(other) {
+		t.Error("Expected the rollback to leave the cache instrumented by the other caller alone")
+	}
+}
+
+func TestInstrumentCacheWithInvalidMetricPrefix(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	for _, prefix := range []string{"bad prefix!", "1app", "_app", "app:checkout"} {
+		if err := InstrumentCache(mustCreateLRUCache(), "prefixed", WithMetricPrefix(prefix)); err == nil {
+			t.Errorf("Expected error for metric prefix %q", prefix)
+		}
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "prefixed", WithMetricPrefix("app-1/checkout_v2")); err != nil {
+		t.Errorf("Expected valid metric prefix to be accepted, got: %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "snapshot"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	cache.Add("key", "value")
+	cache.Get("key")     // hit
+	cache.Get("key")     // hit
+	cache.Get("missing") // miss
+
+	metrics, ok := Snapshot("snapshot")
+	if !ok {
+		t.Fatal("Expected snapshot for instrumented cache")
+	}
+	if metrics.Hits != 2 {
+		t.Errorf("Expected 2 hits, got %d", metrics.Hits)
+	}
+	if metrics.Misses != 1 {
+		t.Errorf("Expected 1 miss, got %d", metrics.Misses)
+	}
+
+	if _, ok := Snapshot("unknown"); ok {
+		t.Error("Expected no snapshot for an unknown cache")
+	}
+}
+
+func TestInstrumentedCaches(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	if names := InstrumentedCaches(); len(names) != 0 {
+		t.Errorf("Expected no instrumented caches, got %v", names)
+	}
+
+	for _, name := range []string{"products", "accounts", "sessions"} {
+		if err := InstrumentCache(mustCreateLRUCache(), name); err != nil {
+			t.Fatalf("Failed to instrument %s: %v", name, err)
+		}
+	}
+
+	names := InstrumentedCaches()
+	expected := []string{"accounts", "products", "sessions"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestInstrumentCacheWithMeterName(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "scoped",
+		WithMeterProvider(provider),
+		WithMeterName("example.com/checkout/cache"),
+		WithInstrumentationVersion("v1.4.0"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("Expected 1 scope, got %d", len(rm.ScopeMetrics))
+	}
+
+	scope := rm.ScopeMetrics[0].Scope
+	if scope.Name != "example.com/checkout/cache" {
+		t.Errorf("Expected scope name example.com/checkout/cache, got %s", scope.Name)
+	}
+	if scope.Version != "v1.4.0" {
+		t.Errorf("Expected scope version v1.4.0, got %s", scope.Version)
+	}
+
+	if RegisteredInstruments(provider, WithMeterName("example.com/checkout/cache"), WithInstrumentationVersion("v1.4.0")) == nil {
+		t.Error("Expected instruments registered under the custom scope")
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithMeterName("")); err == nil {
+		t.Error("Expected error for an empty meter name")
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	cache1 := mustCreateLRUCache()
+	cache2 := mustCreateSyncedCache()
+	if err := InstrumentCaches(map[string]MetricsProvider{"cache1": cache1, "cache2": cache2}); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	cache1.Add("key", "value")
+	cache1.Get("key")     // hit
+	cache2.Get("missing") // miss
+
+	snapshots := Snapshots()
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d", len(snapshots))
+	}
+	if snapshots["cache1"].Hits != 1 {
+		t.Errorf("Expected 1 hit for cache1, got %d", snapshots["cache1"].Hits)
+	}
+	if snapshots["cache2"].Misses != 1 {
+		t.Errorf("Expected 1 miss for cache2, got %d", snapshots["cache2"].Misses)
+	}
+}
+
+func TestAggregateStats(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	if stats := AggregateStats(); stats != (Stats{}) {
+		t.Errorf("Expected empty stats without caches, got %+v", stats)
+	}
+
+	caches := map[string]MetricsProvider{
+		"cache1": &metricsOnlyCache{metrics: freelru.Metrics{Hits: 3, Misses: 1, Evictions: 2}},
+		"cache2": &metricsOnlyCache{metrics: freelru.Metrics{Hits: 1, Misses: 1, Evictions: 5}},
+	}
+	if err := InstrumentCaches(caches); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	expected := Stats{
+		Caches:          2,
+		Hits:            4,
+		Misses:          2,
+		Evictions:       7,
+		AverageHitRatio: (0.75 + 0.5) / 2,
+	}
+	if stats := AggregateStats(); stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := map[string]freelru.Metrics{
+		"steady":   {Inserts: 10, Hits: 5, Misses: 3, Evictions: 1},
+		"replaced": {Inserts: 50, Hits: 40, Misses: 10},
+		"removed":  {Hits: 7},
+	}
+	after := map[string]freelru.Metrics{
+		"steady":   {Inserts: 12, Hits: 9, Misses: 4, Evictions: 1, Removals: 2},
+		"replaced": {Inserts: 5, Hits: 41, Misses: 2},
+		"added":    {Inserts: 3, Hits: 1},
+	}
+
+	expected := map[string]freelru.Metrics{
+		"steady": {Inserts: 2, Hits: 4, Misses: 1, Removals: 2},
+		// Counters lower than before started over
+		"replaced": {Inserts: 5, Hits: 1, Misses: 2},
+		"added":    {Inserts: 3, Hits: 1},
+	}
+	diff := DiffSnapshots(before, after)
+	if len(diff) != len(expected) {
+		t.Errorf("Expected %d caches, got %+v", len(expected), diff)
+	}
+	for name, want := range expected {
+		if got, ok := diff[name]; !ok || got != want {
+			t.Errorf("Expected %+v for %s, got %+v", want, name, got)
+		}
+	}
+}
+
+func TestAggregateByAttribute(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	caches := []struct {
+		name    string
+		plan    string
+		metrics freelru.Metrics
+	}{
+		{"acme", "pro", freelru.Metrics{Hits: 3, Misses: 1, Evictions: 2}},
+		{"globex", "pro", freelru.Metrics{Hits: 1, Misses: 1, Evictions: 5}},
+		{"initech", "free", freelru.Metrics{Hits: 2, Misses: 2}},
+	}
+	for _, c := range caches {
+		err := InstrumentCache(&metricsOnlyCache{metrics: c.metrics}, c.name,
+			WithCacheAttributes(attribute.String("plan", c.plan)))
+		if err != nil {
+			t.Fatalf("Failed to instrument %s: %v", c.name, err)
+		}
+	}
+	if err := InstrumentCache(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 9}}, "unplanned"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	expected := map[string]Stats{
+		"pro":  {Caches: 2, Hits: 4, Misses: 2, Evictions: 7, AverageHitRatio: (0.75 + 0.5) / 2},
+		"free": {Caches: 1, Hits: 2, Misses: 2, AverageHitRatio: 0.5},
+	}
+	groups := AggregateByAttribute("plan")
+	if len(groups) != len(expected) {
+		t.Errorf("Expected %d groups, got %+v", len(expected), groups)
+	}
+	for plan, want := range expected {
+		if got := groups[plan]; got != want {
+			t.Errorf("Expected %+v for plan %s, got %+v", want, plan, got)
+		}
+	}
+
+	if groups := AggregateByAttribute("region"); len(groups) != 0 {
+		t.Errorf("Expected no groups for an unset attribute, got %+v", groups)
+	}
+}
+
+func TestInstrumentCacheExpirationsAreRemovals(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache, err := freelru.New[string, string](2, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := InstrumentCache(cache, "lifetimes", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	// Two capacity evictions: key1 makes room for key3, and key2 for short below
+	cache.Add("key1", "value1")
+	cache.Add("key2", "value2")
+	cache.Add("key3", "value3")
+
+	// One expiration, detected on lookup. freelru doesn't reject a negative lifetime, which expires
+	// the entry right away without depending on the wall clock.
+	cache.AddWithLifetime("short", "value", -time.Hour)
+	cache.Get("short")
+
+	rm := collectMetrics(t, reader)
+
+	for metricName, expected := range map[string]int64{"cache.eviction": 2, "cache.removal": 1} {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Fatalf("%s metric not found", metricName)
+		}
+		dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "lifetimes")
+		if !ok {
+			t.Fatalf("No %s data point found", metricName)
+		}
+		if dp.Value != expected {
+			t.Errorf("Expected %s %d, got %d", metricName, expected, dp.Value)
+		}
+	}
+}
+
+func TestInstrumentFunc(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	var hits uint64
+	err := InstrumentFunc(func() freelru.Metrics {
+		return freelru.Metrics{Hits: hits}
+	}, "closure", WithMeterProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to instrument function: %v", err)
+	}
+
+	hits = 3
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "closure")
+	if !ok {
+		t.Fatal("No data point found for closure")
+	}
+	if dp.Value != 3 {
+		t.Errorf("Expected 3 hits, got %d", dp.Value)
+	}
+
+	// A function has no size
+	if findMetric(rm, "cache.size") != nil {
+		t.Error("Expected no cache.size metric for a function")
+	}
+}
+
+// statsWrapper reports its counts as Metrics, like a package not importing freelru
+type statsWrapper struct {
+	hits, misses uint64
+}
+
+func (w *statsWrapper) Stats() Metrics {
+	return Metrics{Hits: w.hits, Misses: w.misses}
+}
+
+func TestInstrumentStatsFunc(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	wrapper := &statsWrapper{}
+	if err := InstrumentCache(StatsFunc(wrapper.Stats), "wrapper", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument stats function: %v", err)
+	}
+
+	wrapper.hits, wrapper.misses = 4, 1
+
+	rm := collectMetrics(t, reader)
+
+	expectedValues := map[string]int64{
+		"cache.hit":  4,
+		"cache.miss": 1,
+	}
+	for metricName, expected := range expectedValues {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Errorf("%s metric not found", metricName)
+			continue
+		}
+		dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "wrapper")
+		if !ok {
+			t.Errorf("No %s data point found for wrapper", metricName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("%s: expected %d, got %d", metricName, expected, dp.Value)
+		}
+	}
+}
+
+func TestSetEnabled(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "toggled", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	cache.Add("key", "value")
+	cache.Get("key") // hit
+
+	// hitsFor returns the collected hits of the toggled cache, if reported
+	hitsFor := func() (int64, bool) {
+		rm := collectMetrics(t, reader)
+		hitMetric := findMetric(rm, "cache.hit")
+		if hitMetric == nil {
+			return 0, false
+		}
+		dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "toggled")
+		return dp.Value, ok
+	}
+
+	if err := SetEnabled("toggled", false); err != nil {
+		t.Fatalf("Failed to disable cache: %v", err)
+	}
+	cache.Get("key") // hit while disabled
+
+	if _, ok := hitsFor(); ok {
+		t.Error("Expected no data point for a disabled cache")
+	}
+
+	if err := SetEnabled("toggled", true); err != nil {
+		t.Fatalf("Failed to enable cache: %v", err)
+	}
+
+	hits, ok := hitsFor()
+	if !ok {
+		t.Fatal("Expected data point after re-enabling the cache")
+	}
+	if hits != 2 {
+		t.Errorf("Expected cumulative hits 2, got %d", hits)
+	}
+
+	if err := SetEnabled("unknown", false); err == nil {
+		t.Error("Expected error for an unknown cache")
+	}
+}
+
+func TestInstrumentCacheWithAggregateMetrics(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	hits := map[string]uint64{"a": 3, "b": 5, "c": 11}
+	for name, h := range hits {
+		cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: h, Misses: 1}}
+		if err := InstrumentCache(cache, name, WithMeterProvider(provider), WithAggregateMetrics()); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", name, err)
+		}
+	}
+
+	rm := collectMetrics(t, reader)
+
+	for metricName, expected := range map[string]int64{"cache.total.hit": 19, "cache.total.miss": 3} {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Fatalf("%s metric not found", metricName)
+		}
+		dps := m.Data.(metricdata.Sum[int64]).DataPoints
+		if len(dps) != 1 {
+			t.Fatalf("Expected a single %s data point, got %d", metricName, len(dps))
+		}
+		if _, ok := dps[0].Attributes.Value(defaultCacheNameKey); ok {
+			t.Errorf("Expected %s without cache name", metricName)
+		}
+		if dps[0].Value != expected {
+			t.Errorf("Expected %s %d, got %d", metricName, expected, dps[0].Value)
+		}
+	}
+
+	// The per-cache counters are still reported
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	if dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints; len(dps) != len(hits) {
+		t.Errorf("Expected %d cache.hit data points, got %d", len(hits), len(dps))
+	}
+}
+
+// sumValue returns the value of the single data point of the counter with the given name
+func sumValue(t *testing.T, rm *metricdata.ResourceMetrics, name string) int64 {
+	t.Helper()
+	m := findMetric(rm, name)
+	if m == nil {
+		t.Fatalf("%s metric not found", name)
+	}
+	dps := m.Data.(metricdata.Sum[int64]).DataPoints
+	if len(dps) != 1 {
+		t.Fatalf("Expected a single %s data point, got %d", name, len(dps))
+	}
+	return dps[0].Value
+}
+
+func TestAggregateMetricsStayMonotonic(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	hits := map[string]uint64{"a": 3, "b": 5, "c": 11}
+	for name, h := range hits {
+		cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: h}}
+		if err := InstrumentCache(cache, name, WithMeterProvider(provider), WithAggregateMetrics()); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", name, err)
+		}
+	}
+	if got := sumValue(t, collectMetrics(t, reader), "cache.total.hit"); got != 19 {
+		t.Fatalf("Expected 19 hits in total, got %d", got)
+	}
+
+	// Removed caches keep their final values in the totals
+	if err := UninstrumentCache("b"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+	if got := sumValue(t, collectMetrics(t, reader), "cache.total.hit"); got != 19 {
+		t.Errorf("Expected 19 hits in total after uninstrumenting a cache, got %d", got)
+	}
+
+	// So do disabled caches and caches whose counters start over
+	if err := SetEnabled("a", false); err != nil {
+		t.Fatalf("Failed to disable cache: %v", err)
+	}
+	if err := ReplaceCache("c", &metricsOnlyCache{metrics: freelru.Metrics{Hits: 2}}); err != nil {
+		t.Fatalf("Failed to replace cache: %v", err)
+	}
+	if got := sumValue(t, collectMetrics(t, reader), "cache.total.hit"); got != 21 {
+		t.Errorf("Expected 21 hits in total after disabling and replacing caches, got %d", got)
+	}
+}
+
+// panickingSizeCache reports metrics but panics in Len
+type panickingSizeCache struct {
+	metricsOnlyCache
+}
+
+func (panickingSizeCache) Len() int {
+	panic("broken size")
+}
+
+func TestAggregateMetricsSurvivePanickingCollection(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	broken := &panickingSizeCache{metricsOnlyCache{metrics: freelru.Metrics{Hits: 1}}}
+	for name, cache := range map[string]MetricsProvider{
+		"healthy": &metricsOnlyCache{metrics: freelru.Metrics{Hits: 2}},
+		"broken":  broken,
+	} {
+		if err := InstrumentCache(cache, name, WithMeterProvider(provider), WithAggregateMetrics()); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", name, err)
+		}
+	}
+
+	// A panic recovered above the collection, e.g. by net/http, must not leave the totals locked
+	func() {
+		defer func() { _ = recover() }()
+		rm := &metricdata.ResourceMetrics{}
+		_ = reader.Collect(context.Background(), rm)
+	}()
+	if err := UninstrumentCache("broken"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+
+	done := make(chan int64)
+	go func() {
+		rm := &metricdata.ResourceMetrics{}
+		_ = reader.Collect(context.Background(), rm)
+		m := findMetric(rm, "cache.total.hit")
+		if m == nil {
+			done <- -1
+			return
+		}
+		done <- m.Data.(metricdata.Sum[int64]).DataPoints[0].Value
+	}()
+	select {
+	case got := <-done:
+		if got < 2 {
+			t.Errorf("Expected at least 2 hits in total, got %d", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Collection deadlocked after a panicking one")
+	}
+}
+
+func TestInstrumentCacheWithoutAggregateMetrics(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	if err := InstrumentCache(mustCreateLRUCache(), "plain", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	if findMetric(rm, "cache.total.hit") != nil {
+		t.Error("Expected no aggregate metrics by default")
+	}
+}
+
+func TestInstrumentCacheInvalidName(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheName string
+	}{
+		{"empty", ""},
+		{"whitespace only", " \t\n"},
+		{"too long", strings.Repeat("c", maxNameLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reset global state for test isolation
+			resetForTesting()
+
+			if err := InstrumentCache(mustCreateLRUCache(), tt.cacheName); err == nil {
+				t.Fatal("Expected error for invalid cache name")
+			}
+			if names := InstrumentedCaches(); len(names) != 0 {
+				t.Errorf("Expected no instrumented caches, got %v", names)
+			}
+		})
+	}
+
+	// Names of exactly the maximum length are accepted
+	resetForTesting()
+	if err := InstrumentCache(mustCreateLRUCache(), strings.Repeat("c", maxNameLength)); err != nil {
+		t.Errorf("Expected name of maximum length to be accepted, got %v", err)
+	}
+}
+
+func TestInstrumentCacheNil(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache MetricsProvider
+	}{
+		{"nil interface", nil},
+		{"nil pointer", (*freelru.LRU[string, string])(nil)},
+		{"nil func", MetricsFunc(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reset global state for test isolation
+			resetForTesting()
+
+			err := InstrumentCache(tt.cache, "nil")
+			if err == nil || !strings.Contains(err.Error(), "must not be nil") {
+				t.Fatalf("Expected error for a nil cache, got %v", err)
+			}
+			if names := InstrumentedCaches(); len(names) != 0 {
+				t.Errorf("Expected no instrumented caches, got %v", names)
+			}
+		})
+	}
+
+	// Replacing a cache with nil is rejected as well
+	resetForTesting()
+	if err := InstrumentCache(mustCreateLRUCache(), "replaced"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := ReplaceCache("replaced", nil); err == nil {
+		t.Error("Expected error replacing a cache with nil")
+	}
+}
+
+func TestInstrumentCacheSanitizesName(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	if err := InstrumentCache(mustCreateLRUCache(), "my cache!", WithMeterProvider(provider),
+		WithNameSanitizer(SanitizeName)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "raw name", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if _, ok := findDataPoint(dps, "my_cache_"); !ok {
+		t.Error("Expected data point with sanitized cache name my_cache_")
+	}
+	if _, ok := findDataPoint(dps, "raw name"); !ok {
+		t.Error("Expected data point with unsanitized cache name without a sanitizer")
+	}
+
+	// The cache is still looked up by its original name
+	if _, ok := Snapshot("my cache!"); !ok {
+		t.Error("Expected snapshot under the original cache name")
+	}
+}
+
+func TestInstrumentCacheRejectsCollidingSanitizedNames(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	if err := InstrumentCache(mustCreateLRUCache(), "a_b"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	err := InstrumentCache(mustCreateLRUCache(), "a b", WithNameSanitizer(SanitizeName))
+	if err == nil || !strings.Contains(err.Error(), "a_b") {
+		t.Errorf("Expected error naming the colliding cache, got %v", err)
+	}
+	if _, ok := Snapshot("a b"); ok {
+		t.Error("Expected the colliding cache not to be instrumented")
+	}
+
+	// Without sanitizing, the names are reported apart
+	if err := InstrumentCache(mustCreateLRUCache(), "a b"); err != nil {
+		t.Errorf("Failed to instrument cache with a distinct reported name: %v", err)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		"my cache!":         "my_cache_",
+		"checkout.sessions": "checkout.sessions",
+		"svc/cache-1:users": "svc/cache-1:users",
+		"tab\tnewline\n":    "tab_newline_",
+		"caché":             "cach_",
+	}
+	for name, expected := range tests {
+		if got := SanitizeName(name); got != expected {
+			t.Errorf("SanitizeName(%q) = %q, want %q", name, got, expected)
+		}
+	}
+}
+
+func TestInstrumentCacheWithNamespace(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// Per-cache attributes can't override the namespace
+	err := InstrumentCache(mustCreateLRUCache(), "sessions",
+		WithMeterProvider(provider),
+		WithNamespace("checkout"),
+		WithCacheAttributes(attribute.String("namespace", "other")))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	for _, metricName := range []string{"cache.hit", "cache.miss"} {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Fatalf("%s metric not found", metricName)
+		}
+		dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "sessions")
+		if !ok {
+			t.Fatalf("No %s data point found", metricName)
+		}
+		if got, ok := dp.Attributes.Value("namespace"); !ok || got.AsString() != "checkout" {
+			t.Errorf("Expected %s attribute namespace=checkout, got %v", metricName, got.Emit())
+		}
+	}
+
+	if err := New().Instrument(mustCreateLRUCache(), "empty", WithNamespace("")); err == nil {
+		t.Error("Expected error for empty namespace")
+	}
+}
+
+func TestInstrumentCacheSameInstanceTwice(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "a"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(cache, "b"); err == nil {
+		t.Error("Expected error instrumenting the same cache under a second name")
+	}
+	if names := InstrumentedCaches(); len(names) != 1 || names[0] != "a" {
+		t.Errorf("Expected only cache a to be instrumented, got %v", names)
+	}
+
+	// Values that aren't pointers, like funcs, can't be compared and are accepted
+	fn := func() freelru.Metrics { return freelru.Metrics{} }
+	if err := InstrumentFunc(fn, "func1"); err != nil {
+		t.Fatalf("Failed to instrument func: %v", err)
+	}
+	if err := InstrumentFunc(fn, "func2"); err != nil {
+		t.Errorf("Expected func to be accepted under a second name, got %v", err)
+	}
+}
+
+func TestInstrumentCacheLoad(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// A single shard keeps the effective capacity equal to the requested one
+	sharded, err := freelru.NewShardedWithSize[string, string](1, 10, 16, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		sharded.Add(fmt.Sprintf("key%d", i), "value")
+	}
+
+	if err := InstrumentCache(sharded, "half_full", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	empty, err := freelru.NewShardedWithSize[string, string](1, 10, 16, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := InstrumentCache(cappedCache{empty, 0}, "zero_capacity", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(uncappedCache{mustCreateLRUCache()}, "uncapped", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	loadMetric := findMetric(rm, "cache.load")
+	if loadMetric == nil {
+		t.Fatal("cache.load metric not found")
+	}
+	gauge := loadMetric.Data.(metricdata.Gauge[float64])
+
+	dp, ok := findDataPoint(gauge.DataPoints, "half_full")
+	if !ok {
+		t.Fatal("No cache.load data point found for half_full")
+	}
+	if math.Abs(dp.Value-0.5) > 1e-9 {
+		t.Errorf("Expected cache.load 0.5, got %f", dp.Value)
+	}
+
+	if dp, ok := findDataPoint(gauge.DataPoints, "zero_capacity"); !ok || dp.Value != 0 {
+		t.Errorf("Expected cache.load 0 for zero capacity, got %f (found %t)", dp.Value, ok)
+	}
+	if _, ok := findDataPoint(gauge.DataPoints, "uncapped"); ok {
+		t.Error("Expected no cache.load data point for a cache without Cap()")
+	}
+}
+
+func TestRecordPurge(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "purged", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		cache.Purge()
+		if err := RecordPurge("purged"); err != nil {
+			t.Fatalf("Failed to record purge: %v", err)
+		}
+	}
+
+	rm := collectMetrics(t, reader)
+	purgeMetric := findMetric(rm, "cache.purge")
+	if purgeMetric == nil {
+		t.Fatal("cache.purge metric not found")
+	}
+	dp, ok := findDataPoint(purgeMetric.Data.(metricdata.Sum[int64]).DataPoints, "purged")
+	if !ok {
+		t.Fatal("No cache.purge data point found")
+	}
+	if dp.Value != 2 {
+		t.Errorf("Expected cache.purge 2, got %d", dp.Value)
+	}
+
+	if err := RecordPurge("unknown"); err == nil {
+		t.Error("Expected error for an unknown cache")
+	}
+}
+
+func TestRecordHitAndMiss(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "read_through", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	cache.Add("key", "value")
+	cache.Get("key") // hit
+
+	// Lookups short-circuited before reaching the cache
+	for i := 0; i < 2; i++ {
+		if err := RecordHit("read_through"); err != nil {
+			t.Fatalf("Failed to record hit: %v", err)
+		}
+	}
+	if err := RecordMiss("read_through"); err != nil {
+		t.Fatalf("Failed to record miss: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	expectedValues := map[string]int64{
+		"cache.hit":  3,
+		"cache.miss": 1,
+	}
+	for metricName, expected := range expectedValues {
+		m := findMetric(rm, metricName)
+		if m == nil {
+			t.Errorf("%s metric not found", metricName)
+			continue
+		}
+		dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "read_through")
+		if !ok {
+			t.Errorf("No %s data point found", metricName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("%s: expected %d, got %d", metricName, expected, dp.Value)
+		}
+	}
+
+	if snapshot, _ := Snapshot("read_through"); snapshot.Hits != 3 {
+		t.Errorf("Expected the snapshot to include the recorded hits, got %d hits", snapshot.Hits)
+	}
+
+	if err := RecordHit("unknown"); err == nil {
+		t.Error("Expected error for an unknown cache")
+	}
+	if err := RecordMiss("unknown"); err == nil {
+		t.Error("Expected error for an unknown cache")
+	}
+}
+
+func TestInstrumentCacheWithMetricDescription(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	const description = "Number of cache hits, see https://example.com/docs/caching"
+	err := InstrumentCache(mustCreateLRUCache(), "described",
+		WithMeterProvider(provider), WithMetricDescription("cache.hit", description))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	if m := findMetric(rm, "cache.hit"); m == nil || m.Description != description {
+		t.Errorf("Expected cache.hit description %q, got %+v", description, m)
+	}
+	if m := findMetric(rm, "cache.miss"); m == nil || m.Description != "Number of cache misses" {
+		t.Errorf("Expected default cache.miss description, got %+v", m)
+	}
+
+	if err := InstrumentCache(mustCreateLRUCache(), "invalid", WithMetricDescription("cache.unknown", "x")); err == nil {
+		t.Error("Expected error for an unknown metric name")
+	}
+}
+
+func TestInstrumentCacheAfterFirstRegistration(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	if err := InstrumentCache(mustCreateLRUCache(), "first", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument first cache: %v", err)
+	}
+	instruments := RegisteredInstruments(provider)
+
+	// Collect once, so the later caches are added to a registration that is already in use
+	collectMetrics(t, reader)
+
+	if err := InstrumentCache(mustCreateSyncedCache(), "second", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument second cache: %v", err)
+	}
+	third := func() freelru.Metrics { return freelru.Metrics{Hits: 1} }
+	if err := InstrumentFunc(third, "third", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument third cache: %v", err)
+	}
+
+	if later := RegisteredInstruments(provider); later["cache.hit"] != instruments["cache.hit"] {
+		t.Error("Expected the instruments to be registered only once")
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	for _, cacheName := range []string{"first", "second", "third"} {
+		if _, ok := findDataPoint(dps, cacheName); !ok {
+			t.Errorf("Expected data point for %s", cacheName)
+		}
+	}
+}
+
+func TestInstrumentCacheWithSizeAsUpDownCounter(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateLRUCache()
+	cache.Add("key1", "value1")
+	cache.Add("key2", "value2")
+
+	if err := InstrumentCache(cache, "sized", WithMeterProvider(provider), WithSizeAsUpDownCounter()); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	sizeMetric := findMetric(rm, "cache.size")
+	if sizeMetric == nil {
+		t.Fatal("cache.size metric not found")
+	}
+	sum, ok := sizeMetric.Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("Expected cache.size to be a sum, got %T", sizeMetric.Data)
+	}
+	if sum.IsMonotonic {
+		t.Error("Expected cache.size to be a non-monotonic sum")
+	}
+	dp, ok := findDataPoint(sum.DataPoints, "sized")
+	if !ok {
+		t.Fatal("No cache.size data point found")
+	}
+	if dp.Value != 2 {
+		t.Errorf("Expected cache.size 2, got %d", dp.Value)
+	}
+}
+
+func TestInstrumentCacheRegisteredCount(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := InstrumentCache(mustCreateLRUCache(), name, WithMeterProvider(provider)); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", name, err)
+		}
+	}
+
+	// registered returns the single cache.registered data point
+	registered := func() metricdata.DataPoint[int64] {
+		t.Helper()
+		m := findMetric(collectMetrics(t, reader), "cache.registered")
+		if m == nil {
+			t.Fatal("cache.registered metric not found")
+		}
+		dps := m.Data.(metricdata.Gauge[int64]).DataPoints
+		if len(dps) != 1 {
+			t.Fatalf("Expected a single cache.registered data point, got %d", len(dps))
+		}
+		return dps[0]
+	}
+
+	dp := registered()
+	if dp.Value != 3 {
+		t.Errorf("Expected cache.registered 3, got %d", dp.Value)
+	}
+	if _, ok := dp.Attributes.Value(defaultCacheNameKey); ok {
+		t.Error("Expected cache.registered without cache name")
+	}
+
+	if err := UninstrumentCache("b"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+	if dp := registered(); dp.Value != 2 {
+		t.Errorf("Expected cache.registered 2 after uninstrumenting, got %d", dp.Value)
+	}
+}
+
+func TestMustInstrumentCache(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	MustInstrumentCache(mustCreateLRUCache(), "must")
+	if names := InstrumentedCaches(); len(names) != 1 || names[0] != "must" {
+		t.Fatalf("Expected cache must to be instrumented, got %v", names)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic instrumenting a duplicate name")
+		}
+	}()
+	MustInstrumentCache(mustCreateLRUCache(), "must")
+}
+
+// namedCache is a cache reporting its own name
+type namedCache struct {
+	*freelru.LRU[string, string]
+}
+
+func (namedCache) CacheName() string {
+	return "named_sessions"
+}
+
+func TestInstrumentCacheNamed(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := namedCache{mustCreateLRUCache()}
+	if err := InstrumentCacheNamed(cache, cache, WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	if _, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "named_sessions"); !ok {
+		t.Error("Expected data point for the derived name named_sessions")
+	}
+}
+
+// pointerNamedCache is a cache reporting its own name through a pointer receiver
+type pointerNamedCache struct {
+	name string
+}
+
+func (c *pointerNamedCache) CacheName() string {
+	return c.name
+}
+
+func TestInstrumentCacheNamedNilNamer(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	if err := InstrumentCacheNamed(mustCreateLRUCache(), nil); err == nil {
+		t.Error("Expected error for a nil namer")
+	}
+	if err := New().InstrumentCacheNamed(mustCreateLRUCache(), (*pointerNamedCache)(nil)); err == nil {
+		t.Error("Expected error for a nil pointer namer")
+	}
+
+	instrumenter := New()
+	if err := instrumenter.InstrumentCacheNamed(mustCreateLRUCache(), &pointerNamedCache{name: "named"}); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if names := instrumenter.InstrumentedCaches(); len(names) != 1 || names[0] != "named" {
+		t.Errorf("Expected cache named to be instrumented, got %v", names)
+	}
+}
+
+func TestReplaceCache(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	original := &metricsOnlyCache{metrics: freelru.Metrics{Hits: 10}}
+	err := InstrumentCache(original, "rebuilt", WithMeterProvider(provider),
+		WithCacheAttributes(attribute.String("team", "identity")))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	replacement := &metricsOnlyCache{metrics: freelru.Metrics{Hits: 2}}
+	if err := ReplaceCache("rebuilt", replacement); err != nil {
+		t.Fatalf("Failed to replace cache: %v", err)
+	}
+
+	if metrics, ok := Snapshot("rebuilt"); !ok || metrics.Hits != 2 {
+		t.Errorf("Expected snapshot of the new cache with 2 hits, got %+v", metrics)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "rebuilt")
+	if !ok {
+		t.Fatal("No cache.hit data point found")
+	}
+	if dp.Value != 2 {
+		t.Errorf("Expected hits of the new cache 2, got %d", dp.Value)
+	}
+	if team, _ := dp.Attributes.Value("team"); team.AsString() != "identity" {
+		t.Errorf("Expected attributes to be kept, got team=%s", team.Emit())
+	}
+
+	if err := ReplaceCache("unknown", mustCreateLRUCache()); err == nil {
+		t.Error("Expected error replacing an unknown cache")
+	}
+}
+
+func TestInstrumentCacheCtx(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := InstrumentCacheCtx(ctx, mustCreateLRUCache(), "scoped"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if _, ok := Snapshot("scoped"); !ok {
+		t.Fatal("Expected cache to be instrumented")
+	}
+
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := Snapshot("scoped"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected cache to be uninstrumented after the context was cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := InstrumentCacheCtx(ctx, mustCreateLRUCache(), "late"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled for a done context, got %v", err)
+	}
+}
+
+func TestInstrumentCacheCtxKeepsReusedName(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := InstrumentCacheCtx(ctx, mustCreateLRUCache(), "reused"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	entry, _ := defaultInstrumenter.registry.get("reused")
+
+	// Once the name is taken by another cache, cancelling the context must not remove it
+	if err := UninstrumentCache("reused"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+	// The context isn't done yet, so the removal can only fail to stop if it was stopped already
+	if entry.stop() {
+		t.Fatal("Expected uninstrumenting to stop the removal on cancellation")
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "reused"); err != nil {
+		t.Fatalf("Failed to instrument cache again: %v", err)
+	}
+	cancel()
+
+	if _, ok := Snapshot("reused"); !ok {
+		t.Error("Expected the cache instrumented later to stay instrumented")
+	}
+}
+
+func TestInstrumentCacheCtxDoesNotLeakGoroutines(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("cache%d", i)
+		if err := InstrumentCacheCtx(context.Background(), mustCreateLRUCache(), name+"_background"); err != nil {
+			t.Fatalf("Failed to instrument cache: %v", err)
+		}
+		if err := InstrumentCacheCtx(ctx, mustCreateLRUCache(), name); err != nil {
+			t.Fatalf("Failed to instrument cache: %v", err)
+		}
+		if err := UninstrumentCache(name); err != nil {
+			t.Fatalf("Failed to uninstrument cache: %v", err)
+		}
+	}
+	if err := Shutdown(); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+
+	// Waiting on a context would take a goroutine per call
+	if after := runtime.NumGoroutine(); after-before >= 100 {
+		t.Errorf("Expected no goroutine per call, got %d goroutines before and %d after", before, after)
+	}
+}
+
+func TestInstrumentCacheWithCleanup(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cleanup, err := InstrumentCacheWithCleanup(mustCreateLRUCache(), "scoped", WithMeterProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "other", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	if err := cleanup(); err != nil {
+		t.Fatalf("Failed to clean up: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if _, ok := findDataPoint(dps, "scoped"); ok {
+		t.Error("Expected no data point for the cleaned up cache")
+	}
+	if _, ok := findDataPoint(dps, "other"); !ok {
+		t.Error("Expected the other cache to stay instrumented")
+	}
+
+	if err := cleanup(); err == nil {
+		t.Error("Expected an error cleaning up twice")
+	}
+
+	if _, err := InstrumentCacheWithCleanup(mustCreateLRUCache(), "other"); err == nil {
+		t.Error("Expected an error for a duplicate name")
+	}
+}
+
+func TestInstrumentCacheWithCleanupRegistrationError(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	cleanup, err := InstrumentCacheWithCleanup(mustCreateLRUCache(), "cleaned", WithMeter(failingMeter{}))
+	if err == nil {
+		t.Fatal("Expected error when the metrics can't be registered")
+	}
+	if cleanup != nil {
+		t.Error("Expected no cleanup function on error")
+	}
+
+	// Without a cleanup function the name must be free already
+	if err := InstrumentCache(mustCreateLRUCache(), "cleaned"); err != nil {
+		t.Errorf("Expected name to be free after the failed call, got: %v", err)
+	}
+}
+
+func TestInstrumentCacheWithMeter(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+	meter := provider.Meter("example.com/checkout")
+
+	// The meter takes precedence over the provider and scope options
+	err := InstrumentCache(mustCreateLRUCache(), "metered", WithMeter(meter),
+		WithMeterProvider(metric.NewMeterProvider()), WithMeterName("ignored"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("Expected 1 scope, got %d", len(rm.ScopeMetrics))
+	}
+	if scope := rm.ScopeMetrics[0].Scope.Name; scope != "example.com/checkout" {
+		t.Errorf("Expected scope of the given meter, got %s", scope)
+	}
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	if _, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "metered"); !ok {
+		t.Error("Expected data point for cache metered")
+	}
+}
+
+func TestInstrumentCacheStartTime(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	cache := mustCreateLRUCache()
+	if err := InstrumentCache(cache, "timed", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	// startTime returns the start time of the cache.hit data point of cache timed
+	startTime := func() time.Time {
+		t.Helper()
+		hitMetric := findMetric(collectMetrics(t, reader), "cache.hit")
+		if hitMetric == nil {
+			t.Fatal("cache.hit metric not found")
+		}
+		dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "timed")
+		if !ok {
+			t.Fatal("No cache.hit data point found")
+		}
+		return dp.StartTime
+	}
+
+	first := startTime()
+	if first.IsZero() {
+		t.Fatal("Expected a non-zero start time")
+	}
+
+	cache.Add("key", "value")
+	cache.Get("key")
+
+	if second := startTime(); !second.Equal(first) {
+		t.Errorf("Expected stable start time %v across collections, got %v", first, second)
+	}
+}
+
+func TestInstrumentCacheWithExpiredFunc(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "ttl", WithMeterProvider(provider),
+		WithExpiredFunc(func() int { return 7 }))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := InstrumentCache(mustCreateLRUCache(), "no_ttl", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	expiredMetric := findMetric(rm, "cache.expired")
+	if expiredMetric == nil {
+		t.Fatal("cache.expired metric not found")
+	}
+	dps := expiredMetric.Data.(metricdata.Gauge[int64]).DataPoints
+	dp, ok := findDataPoint(dps, "ttl")
+	if !ok {
+		t.Fatal("No cache.expired data point found")
+	}
+	if dp.Value != 7 {
+		t.Errorf("Expected cache.expired 7, got %d", dp.Value)
+	}
+	if _, ok := findDataPoint(dps, "no_ttl"); ok {
+		t.Error("Expected no cache.expired data point without an expired func")
+	}
+}
+
+// kindedCache is a cache reporting its own kind
+type kindedCache struct {
+	metricsOnlyCache
+}
+
+func (*kindedCache) Kind() string {
+	return "custom"
+}
+
+func TestInstrumentCacheType(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	caches := map[string]MetricsProvider{
+		"lru":     mustCreateLRUCache(),
+		"synced":  mustCreateSyncedCache(),
+		"sharded": mustCreateShardedCache(),
+		"custom":  &kindedCache{},
+		"unknown": &metricsOnlyCache{},
+	}
+	if err := InstrumentCaches(caches, WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+	// Each cache is named after its expected type
+	for expected := range caches {
+		dp, ok := findDataPoint(dps, expected)
+		if !ok {
+			t.Errorf("No data point found for %s", expected)
+			continue
+		}
+		if got, _ := dp.Attributes.Value(cacheTypeKey); got.AsString() != expected {
+			t.Errorf("Expected cache_type %s, got %s", expected, got.Emit())
+		}
+	}
+}
+
+// hashIntMultiplicative hashes int keys by Knuth's multiplicative method, unlike the xxhash used elsewhere
+func hashIntMultiplicative(key int) uint32 {
+	return uint32(key) * 2654435761
+}
+
+func TestInstrumentCacheIndependentOfHasher(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	hash := hashIntMultiplicative
+	lru, err := freelru.NewWithSize[int, int](10, 16, hash)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	synced, err := freelru.NewSyncedWithSize[int, int](10, 16, hash)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	sharded, err := freelru.NewShardedWithSize[int, int](4, 40, 64, hash)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	exerciseCache[int, int](lru, 1, 1, 2)
+	exerciseCache[int, int](synced, 1, 1, 2)
+	exerciseCache[int, int](sharded, 1, 1, 2)
+
+	caches := map[string]MetricsProvider{"lru": lru, "synced": synced, "sharded": sharded}
+	if err := InstrumentCaches(caches, WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	shardsMetric := findMetric(rm, "cache.shards")
+	if shardsMetric == nil {
+		t.Fatal("cache.shards metric not found")
+	}
+
+	expectedShards := map[string]int64{"lru": 1, "synced": 1, "sharded": 4}
+	for name, shards := range expectedShards {
+		dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, name)
+		if !ok {
+			t.Errorf("No cache.hit data point found for %s", name)
+			continue
+		}
+		if dp.Value != 1 {
+			t.Errorf("Expected 1 hit for %s, got %d", name, dp.Value)
+		}
+		if got, _ := dp.Attributes.Value(cacheTypeKey); got.AsString() != name {
+			t.Errorf("Expected cache_type %s, got %s", name, got.Emit())
+		}
+
+		shardsDP, ok := findDataPoint(shardsMetric.Data.(metricdata.Gauge[int64]).DataPoints, name)
+		if !ok || shardsDP.Value != shards {
+			t.Errorf("Expected %d shards for %s, got %d", shards, name, shardsDP.Value)
+		}
+	}
+}
+
+func TestInstrumentCacheWithConstLabelsFromEnv(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	t.Setenv("FREELRUOTEL_TEST_POD_NAME", "checkout-7d9f")
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "env", WithMeterProvider(provider),
+		WithConstLabelsFromEnv(map[string]string{
+			"k8s.pod.name":  "FREELRUOTEL_TEST_POD_NAME",
+			"k8s.node.name": "FREELRUOTEL_TEST_UNSET",
+		}))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "env")
+	if !ok {
+		t.Fatal("No cache.hit data point found")
+	}
+	if got, ok := dp.Attributes.Value("k8s.pod.name"); !ok || got.AsString() != "checkout-7d9f" {
+		t.Errorf("Expected k8s.pod.name from the environment, got %s", got.Emit())
+	}
+	if _, ok := dp.Attributes.Value("k8s.node.name"); ok {
+		t.Error("Expected unset variable to be skipped")
+	}
+}
+
+func TestInstrumentCacheWithSkipZeroValues(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	warm := mustCreateLRUCache()
+	warm.Add("key", "value")
+	warm.Get("key")
+	caches := map[string]MetricsProvider{"cold": mustCreateLRUCache(), "warm": warm}
+	if err := InstrumentCaches(caches, WithMeterProvider(provider), WithSkipZeroValues()); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	// dataPoints returns the data points of a counter, which is left out entirely without any
+	dataPoints := func(name string) []metricdata.DataPoint[int64] {
+		m := findMetric(rm, name)
+		if m == nil {
+			return nil
+		}
+		return m.Data.(metricdata.Sum[int64]).DataPoints
+	}
+
+	for _, name := range []string{MetricCacheHit, MetricCacheMiss, MetricCacheInsert, MetricCacheEviction,
+		MetricCacheCollision, MetricCacheRemoval, MetricCachePurge} {
+		if _, ok := findDataPoint(dataPoints(name), "cold"); ok {
+			t.Errorf("Expected no %s data point for the never used cache", name)
+		}
+	}
+
+	if dp, ok := findDataPoint(dataPoints(MetricCacheHit), "warm"); !ok || dp.Value != 1 {
+		t.Errorf("Expected 1 hit for the used cache, got %d", dp.Value)
+	}
+	if _, ok := findDataPoint(dataPoints(MetricCacheEviction), "warm"); ok {
+		t.Error("Expected no cache.eviction data point without evictions")
+	}
+
+	// Gauges are still reported
+	if findMetric(rm, MetricCacheHitRatio) == nil {
+		t.Error("Expected cache.hit_ratio to be reported")
+	}
+}
+
+func TestInstrumentCacheWithDeployment(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	err := InstrumentCache(mustCreateLRUCache(), "canary", WithMeterProvider(provider), WithDeployment("canary"))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	err = InstrumentCache(mustCreateLRUCache(), "staging", WithMeterProvider(provider), WithDeployment("staging"))
+	if err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Errorf("Expected error naming the unknown stage, got %v", err)
+	}
+	if _, ok := Snapshot("staging"); ok {
+		t.Error("Cache with an unknown stage should not be instrumented")
+	}
+
+	rm := collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "canary")
+	if !ok {
+		t.Fatal("No cache.hit data point found")
+	}
+	if got, ok := dp.Attributes.Value("deployment"); !ok || got.AsString() != "canary" {
+		t.Errorf("Expected deployment=canary, got %s", got.Emit())
+	}
+}
+
+// shardedCache wraps a freelru.ShardedLRU to report its configured number of shards
+type shardedCache struct {
+	*freelru.ShardedLRU[string, string]
+	shards int
+}
+
+func (c shardedCache) Shards() int {
+	return c.shards
+}
+
+func TestInstrumentCacheShards(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	sharded, err := freelru.NewShardedWithSize[string, string](4, 1024, 1024, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := InstrumentCache(shardedCache{sharded, 4}, "sharded", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	shardsMetric := findMetric(rm, "cache.shards")
+	if shardsMetric == nil {
+		t.Fatal("cache.shards metric not found")
+	}
+	dp, ok := findDataPoint(shardsMetric.Data.(metricdata.Gauge[int64]).DataPoints, "sharded")
+	if !ok {
+		t.Fatal("No cache.shards data point found")
+	}
+	if dp.Value != 4 {
+		t.Errorf("Expected cache.shards 4, got %d", dp.Value)
+	}
+}
+
+func TestInstrumentCacheDetectsShards(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	sharded, err := freelru.NewShardedWithSize[string, string](8, 1024, 1024, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	caches := map[string]MetricsProvider{
+		"plain":   mustCreateLRUCache(),
+		"synced":  mustCreateSyncedCache(),
+		"sharded": sharded,
+		"func":    MetricsFunc(func() freelru.Metrics { return freelru.Metrics{} }),
+	}
+	if err := InstrumentCaches(caches, WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument caches: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+	shardsMetric := findMetric(rm, "cache.shards")
+	if shardsMetric == nil {
+		t.Fatal("cache.shards metric not found")
+	}
+	dps := shardsMetric.Data.(metricdata.Gauge[int64]).DataPoints
+
+	expectedShards := map[string]int64{
+		"plain":   1,
+		"synced":  1,
+		"sharded": 8,
+	}
+	for cacheName, expected := range expectedShards {
+		dp, ok := findDataPoint(dps, cacheName)
+		if !ok {
+			t.Errorf("No cache.shards data point found for %s", cacheName)
+			continue
+		}
+		if dp.Value != expected {
+			t.Errorf("Cache %s: expected %d shards, got %d", cacheName, expected, dp.Value)
+		}
+	}
+	if _, ok := findDataPoint(dps, "func"); ok {
+		t.Error("Expected no cache.shards data point for a function")
+	}
+}
+
+func TestRegisteredMetricNamesMatchConstants(t *testing.T) {
+	resetForTesting()
+
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// Capacity and expired entries are only reported for caches providing them
+	cache, err := freelru.NewShardedWithSize[string, string](1, 10, 16, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	err = InstrumentCache(cappedCache{cache, 10}, "names", WithMeterProvider(provider),
+		WithExpiredFunc(func() int { return 0 }))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	// The shards of a wrapped cache are unknown, those of a plain LRU are not
+	if err := InstrumentCache(mustCreateLRUCache(), "plain", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	names := []string{
+		MetricCacheHit, MetricCacheMiss, MetricCacheInsert, MetricCacheEviction,
+		MetricCacheCollision, MetricCacheRemoval, MetricCachePurge,
+		MetricCacheSize, MetricCacheCapacity, MetricCacheLoad, MetricCacheShards, MetricCacheExpired,
+		MetricCacheHitRatio, MetricCacheCollisionRate, MetricCacheLastObserved, MetricCacheNetEntries,
+		MetricCacheRegistered, MetricCacheRegistryHealthy,
+	}
+	for _, name := range names {
+		if findMetric(rm, name) == nil {
+			t.Errorf("Metric %s not registered", name)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package freelruotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// maxNameLength is the maximum number of characters of a cache name
+const maxNameLength = 255
+
+// validateName reports why name can't be used as a cache name, if it can't
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("cache name must not be empty or whitespace only")
+	}
+	if n := utf8.RuneCountInString(name); n > maxNameLength {
+		return fmt.Errorf("cache name must not exceed %d characters, got %d", maxNameLength, n)
+	}
+	return nil
+}
+
+// validateCache reports an error if cache is nil, including nil pointers and funcs in a non-nil
+// interface, as calling its Metrics method would panic on every collection
+func validateCache(cache MetricsProvider) error {
+	if cache == nil {
+		return errors.New("cache must not be nil")
+	}
+	switch v := reflect.ValueOf(cache); v.Kind() {
+	case reflect.Pointer, reflect.Func, reflect.Map, reflect.Slice, reflect.Chan, reflect.Interface:
+		if v.IsNil() {
+			return fmt.Errorf("cache must not be nil, got a nil %T", cache)
+		}
+	}
+	return nil
+}
+
+// Instrumenter tracks a set of instrumented caches and the meters their metrics are registered with.
+// Instrumenters are isolated from each other: caches instrumented by one are never observed by the
+// meters of another. The package-level functions use a default Instrumenter.
+type Instrumenter struct {
+	opts     []Option
+	registry *cacheRegistry
+
+	// meters holds the registrations of meters that already have the cache metrics registered
+	metersMu sync.Mutex
+	meters   map[metric.Meter]*registration
+}
+
+// New creates an Instrumenter. The options are applied to every Instrument call before the
+// options passed to the call itself, so invalid options are reported by Instrument.
+func New(opts ...Option) *Instrumenter {
+	return &Instrumenter{
+		opts:     opts,
+		registry: &cacheRegistry{},
+		meters:   make(map[metric.Meter]*registration),
+	}
+}
+
+// config returns the config of a call with opts, applying the options given to New first
+func (i *Instrumenter) config(opts []Option) *config {
+	cfg := newConfig()
+	for _, opt := range i.opts {
+		opt(cfg)
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Instrument registers OpenTelemetry Observable Counter metrics of any instance of freelru cache.
+// The cache must not be nil. The name must contain a non-whitespace character and at most 255
+// characters. Instrumenting the same cache instance under a second name is rejected, as it would
+// be counted twice.
+//
+// Metrics are registered once per MeterProvider: the first call using a given provider creates the
+// instruments, and later calls with a different provider register them against that provider too.
+// All providers observe every cache instrumented by i, regardless of which provider was passed
+// along with the cache.
+func (i *Instrumenter) Instrument(cache MetricsProvider, name string, opts ...Option) error {
+	_, err := i.instrument(cache, name, opts)
+	return err
+}
+
+// InstrumentCtx instruments cache under name like Instrument, and uninstruments it once ctx is done,
+// e.g. for caches scoped to a request or connection. The cache is only removed if it's still
+// registered under name by this call, or replaced by Replace. It returns ctx's error if ctx is
+// already done.
+func (i *Instrumenter) InstrumentCtx(ctx context.Context, cache MetricsProvider, name string, opts ...Option) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entry, err := i.instrument(cache, name, opts)
+	if err != nil {
+		return err
+	}
+
+	// The removal is unregistered when the entry is removed otherwise, so nothing outlives the entry
+	stop := context.AfterFunc(ctx, func() {
+		i.registry.removeEntry(name, entry.id)
+	})
+	if !i.registry.watch(name, entry.id, stop) {
+		// The entry was removed in the meantime
+		stop()
+	}
+	return nil
+}
+
+// InstrumentWithCleanup instruments cache under name like Instrument, and returns a function
+// uninstrumenting it again, e.g. to defer right away. The function only removes the cache if it's
+// still registered under name by this call, or replaced by Replace, and returns an error otherwise.
+func (i *Instrumenter) InstrumentWithCleanup(cache MetricsProvider, name string, opts ...Option) (func() error, error) {
+	entry, err := i.instrument(cache, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		if !i.registry.removeEntry(name, entry.id) {
+			return fmt.Errorf("cache with name '%s' does not exist", name)
+		}
+		return nil
+	}, nil
+}
+
+// instrument adds cache to the registry under name and registers the metrics with the meter of opts.
+// It returns the added entry, which is nil if the call failed and the cache wasn't kept.
+func (i *Instrumenter) instrument(cache MetricsProvider, name string, opts []Option) (*cacheEntry, error) {
+	cfg := i.config(opts)
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if err := validateCache(cache); err != nil {
+		return nil, err
+	}
+
+	// Without a meter nothing would ever be reported, so reject the cache before adding it
+	meter := cfg.meter()
+	if meter == nil {
+		return nil, errNilMeter
+	}
+
+	// Add the cache to our registry
+	entry := &cacheEntry{
+		cache:        cache,
+		attributes:   cfg.cacheAttributes,
+		reportedName: cfg.reportedName(name),
+		kind:         cacheKind(cache),
+		shards:       freelruShards(cache),
+		capacity:     freelruCapacity(cache),
+		created:      now(),
+		expired:      cfg.expiredFunc,
+	}
+	if err := i.registry.add(entry, name); err != nil {
+		return nil, err
+	}
+	if n := i.registry.len(); cfg.cardinalityWarn > 0 && n > cfg.cardinalityWarn {
+		cfg.log(context.Background(), slog.LevelWarn, "number of instrumented caches exceeds the warning threshold",
+			slog.String("cache", name), slog.Int("caches", n), slog.Int("threshold", cfg.cardinalityWarn))
+	}
+
+	if err := i.registerMeter(meter, cfg); err != nil {
+		// Free the name again, so a failed call leaves the registry as it was
+		i.registry.removeEntry(name, entry.id)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// InstrumentCacheNamed instruments cache under the name returned by namer.CacheName(), like Instrument.
+// It returns an error if namer is nil.
+func (i *Instrumenter) InstrumentCacheNamed(cache MetricsProvider, namer Namer, opts ...Option) error {
+	if namer == nil {
+		return errors.New("namer must not be nil")
+	}
+	switch v := reflect.ValueOf(namer); v.Kind() {
+	case reflect.Pointer, reflect.Func, reflect.Map, reflect.Slice, reflect.Chan, reflect.Interface:
+		if v.IsNil() {
+			return fmt.Errorf("namer must not be nil, got a nil %T", namer)
+		}
+	}
+	return i.Instrument(cache, namer.CacheName(), opts...)
+}
+
+// InstrumentFunc instruments the metrics returned by fn under name, like Instrument.
+func (i *Instrumenter) InstrumentFunc(fn MetricsFunc, name string, opts ...Option) error {
+	return i.Instrument(fn, name, opts...)
+}
+
+// InstrumentAll instruments every cache in caches under its map key, applying opts to each call.
+// Caches are instrumented in name order. If any of them fails, the caches instrumented by this call
+// are removed again, so the registry is left as it was, and the error is returned.
+func (i *Instrumenter) InstrumentAll(caches map[string]MetricsProvider, opts ...Option) error {
+	names := make([]string, 0, len(caches))
+	for name := range caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	added := make([]namedEntry, 0, len(names))
+	for _, name := range names {
+		entry, err := i.instrument(caches[name], name, opts)
+		if err != nil {
+			// Roll back only the entries this call inserted, leaving caches instrumented under the
+			// same names by others meanwhile alone
+			for _, a := range added {
+				i.registry.removeEntry(a.name, a.entry.id)
+			}
+			return err
+		}
+		added = append(added, namedEntry{name, entry})
+	}
+
+	return nil
+}
+
+// Uninstrument stops reporting metrics for the cache registered under name.
+// It returns an error if no cache with that name is instrumented.
+func (i *Instrumenter) Uninstrument(name string) error {
+	return i.registry.remove(name)
+}
+
+// Replace swaps the cache registered under name for cache, e.g. after rebuilding it with a new
+// capacity, keeping its attributes. The counters of freelru caches belong to the instance, so they
+// start over from the new cache's values. It returns an error if no cache with that name is
+// instrumented.
+func (i *Instrumenter) Replace(name string, cache MetricsProvider) error {
+	if err := validateCache(cache); err != nil {
+		return err
+	}
+	return i.registry.replace(name, cache)
+}
+
+// SetEnabled suspends or resumes reporting metrics for the cache registered under name.
+// A disabled cache stays instrumented, so reporting resumes with its cumulative counters.
+// It returns an error if no cache with that name is instrumented.
+func (i *Instrumenter) SetEnabled(name string, enabled bool) error {
+	entry, exists := i.registry.get(name)
+	if !exists {
+		return fmt.Errorf("cache with name '%s' does not exist", name)
+	}
+	entry.disabled.Store(!enabled)
+	return nil
+}
+
+// RecordPurge counts a purge of the cache registered under name in the cache.purge counter.
+// freelru doesn't track purges, so call it next to the cache's Purge method. Purging also resets
+// freelru's own counters, which the other counters report as a drop.
+// It returns an error if no cache with that name is instrumented.
+func (i *Instrumenter) RecordPurge(name string) error {
+	entry, exists := i.registry.get(name)
+	if !exists {
+		return fmt.Errorf("cache with name '%s' does not exist", name)
+	}
+	entry.purges.Add(1)
+	return nil
+}
+
+// RecordHit counts a hit of the cache registered under name that the cache itself didn't see,
+// e.g. a lookup answered by a layer in front of it. Recorded hits are added to the cache's own
+// hits in cache.hit and the derived metrics.
+// It returns an error if no cache with that name is instrumented.
+func (i *Instrumenter) RecordHit(name string) error {
+	entry, exists := i.registry.get(name)
+	if !exists {
+		return fmt.Errorf("cache with name '%s' does not exist", name)
+	}
+	entry.hits.Add(1)
+	return nil
+}
+
+// RecordMiss counts a miss of the cache registered under name that the cache itself didn't see,
+// like RecordHit. It returns an error if no cache with that name is instrumented.
+func (i *Instrumenter) RecordMiss(name string) error {
+	entry, exists := i.registry.get(name)
+	if !exists {
+		return fmt.Errorf("cache with name '%s' does not exist", name)
+	}
+	entry.misses.Add(1)
+	return nil
+}
+
+// InstrumentedCaches returns the names of all caches instrumented by i in sorted order.
+func (i *Instrumenter) InstrumentedCaches() []string {
+	return i.registry.names()
+}
+
+// Snapshot returns the current metrics of the cache instrumented under name, including the lookups
+// recorded by RecordHit and RecordMiss, and whether such a cache exists. A cache whose Metrics method
+// panics is reported to the OTel error handler and treated as missing.
+func (i *Instrumenter) Snapshot(name string) (freelru.Metrics, bool) {
+	entry, exists := i.registry.get(name)
+	if !exists {
+		return freelru.Metrics{}, false
+	}
+	return snapshot(name, entry)
+}
+
+// Snapshots returns the current metrics of every cache instrumented by i, keyed by cache name.
+// Caches whose Metrics method panics are left out, like in Snapshot.
+func (i *Instrumenter) Snapshots() map[string]freelru.Metrics {
+	snapshots := make(map[string]freelru.Metrics)
+	i.registry.forEach(func(name string, entry *cacheEntry) bool {
+		if metrics, ok := snapshot(name, entry); ok {
+			snapshots[name] = metrics
+		}
+		return true
+	})
+	return snapshots
+}
+
+// snapshot reads the metrics of entry including the recorded lookups, recovering a panic in Metrics,
+// so one broken provider can't crash the callers, e.g. a scrape of the HTTP handler
+func snapshot(name string, entry *cacheEntry) (freelru.Metrics, bool) {
+	metrics, err := readMetrics(entry.cache)
+	if err != nil {
+		otel.Handle(fmt.Errorf("freelruotel: cache '%s': %w", name, err))
+		return freelru.Metrics{}, false
+	}
+	return entry.withRecorded(metrics), true
+}
+
+// Stats holds totals across all caches of an Instrumenter, e.g. for a status endpoint.
+type Stats struct {
+	// Caches is the number of instrumented caches
+	Caches int
+
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+
+	// AverageHitRatio is the mean of the hit ratios of the caches, each counting equally
+	// regardless of its number of lookups. It's 0 without caches.
+	AverageHitRatio float64
+}
+
+// add adds the metrics of a cache to s. AverageHitRatio holds the sum of the ratios until average is called.
+func (s *Stats) add(metrics freelru.Metrics) {
+	s.Caches++
+	s.Hits = addSaturating(s.Hits, metrics.Hits)
+	s.Misses = addSaturating(s.Misses, metrics.Misses)
+	s.Evictions = addSaturating(s.Evictions, metrics.Evictions)
+	s.AverageHitRatio += hitRatio(metrics)
+}
+
+// average turns the sum of the hit ratios collected by add into their mean
+func (s *Stats) average() {
+	if s.Caches > 0 {
+		s.AverageHitRatio /= float64(s.Caches)
+	}
+}
+
+// AggregateStats returns the totals across every cache instrumented by i, reading the metrics of
+// each cache once. Like Snapshot, the counts include the lookups recorded by RecordHit and RecordMiss,
+// and caches whose Metrics method panics are left out.
+func (i *Instrumenter) AggregateStats() Stats {
+	var stats Stats
+	i.registry.forEach(func(name string, entry *cacheEntry) bool {
+		if metrics, ok := snapshot(name, entry); ok {
+			stats.add(metrics)
+		}
+		return true
+	})
+	stats.average()
+	return stats
+}
+
+// AggregateByAttribute returns the totals like AggregateStats, grouped by the value of the attribute
+// key set with WithCacheAttributes, e.g. a customer plan. The groups are keyed by the value as
+// emitted by attribute.Value.Emit. Caches without the attribute are left out, and if a cache carries
+// key more than once, the last value counts, as for the reported attributes.
+func (i *Instrumenter) AggregateByAttribute(key string) map[string]Stats {
+	groups := make(map[string]Stats)
+	i.registry.forEach(func(name string, entry *cacheEntry) bool {
+		value, ok := cacheAttribute(entry.attributes, attribute.Key(key))
+		if !ok {
+			return true
+		}
+		metrics, ok := snapshot(name, entry)
+		if !ok {
+			return true
+		}
+		stats := groups[value]
+		stats.add(metrics)
+		groups[value] = stats
+		return true
+	})
+	for value, stats := range groups {
+		stats.average()
+		groups[value] = stats
+	}
+	return groups
+}
+
+// cacheAttribute returns the emitted value of the last attribute in attrs with the given key
+func cacheAttribute(attrs []attribute.KeyValue, key attribute.Key) (string, bool) {
+	for j := len(attrs) - 1; j >= 0; j-- {
+		if attrs[j].Key == key {
+			return attrs[j].Value.Emit(), true
+		}
+	}
+	return "", false
+}
+
+// CreatedTimes returns when every cache instrumented by i was instrumented, keyed by cache name,
+// e.g. for the created timestamps of OpenMetrics counters. The time of a cache swapped in by Replace
+// is the time of the replacement, as its counters start over.
+func (i *Instrumenter) CreatedTimes() map[string]time.Time {
+	created := make(map[string]time.Time)
+	i.registry.forEach(func(name string, entry *cacheEntry) bool {
+		created[name] = entry.created
+		return true
+	})
+	return created
+}
+
+// RegisteredInstruments returns the counters registered with provider, keyed by their unprefixed
+// metric name, e.g. "cache.hit". It returns nil if no cache was instrumented with provider.
+// The counters can be observed by additional callbacks registered on the same provider.
+// When the instrumentation scope was changed, e.g. with WithMeterName, pass the same options
+// to select it. Counters registered with WithMeter are selected by passing the same WithMeter
+// option, which takes precedence over provider as it does when instrumenting.
+func (i *Instrumenter) RegisteredInstruments(provider metric.MeterProvider, opts ...Option) map[string]metric.Int64ObservableCounter {
+	cfg := i.config(opts)
+	if cfg.err != nil {
+		return nil
+	}
+	cfg.meterProvider = provider
+
+	meter := cfg.meter()
+	if meter == nil {
+		return nil
+	}
+
+	i.metersMu.Lock()
+	defer i.metersMu.Unlock()
+
+	reg, exists := i.meters[meter]
+	if !exists {
+		return nil
+	}
+
+	counters := make(map[string]metric.Int64ObservableCounter, len(reg.counters))
+	for _, c := range reg.counters {
+		counters[c.name] = c.observer
+	}
+	return counters
+}
+
+// MetricsRegistered reports whether i registered the cache metrics with any meter, i.e. whether a
+// cache was instrumented with a meter since i was created or shut down.
+func (i *Instrumenter) MetricsRegistered() bool {
+	i.metersMu.Lock()
+	defer i.metersMu.Unlock()
+	return len(i.meters) > 0
+}
+
+// Shutdown unregisters the callbacks observing the caches from every meter and removes all
+// instrumented caches. i can be used again afterwards, registering the metrics anew.
+// Errors unregistering the callbacks are joined.
+func (i *Instrumenter) Shutdown() error {
+	i.metersMu.Lock()
+	defer i.metersMu.Unlock()
+
+	var errs []error
+	for meter, reg := range i.meters {
+		if err := reg.unregister(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(i.meters, meter)
+	}
+	i.registry.clear()
+
+	return errors.Join(errs...)
+}
+
+// registerMeter registers all cache metrics with meter unless that was done by an earlier call
+func (i *Instrumenter) registerMeter(meter metric.Meter, cfg *config) error {
+	i.metersMu.Lock()
+	defer i.metersMu.Unlock()
+
+	if _, exists := i.meters[meter]; exists {
+		return nil
+	}
+
+	reg, err := registerAllMetrics(meter, cfg, i.registry)
+	if err != nil {
+		return err
+	}
+
+	i.meters[meter] = reg
+	return nil
+}
@@ -0,0 +1,352 @@
+package freelruotel
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestInstrumentersAreIsolated(t *testing.T) {
+	readerA := metric.NewManualReader()
+	instrumenterA := New(WithMeterProvider(metric.NewMeterProvider(metric.WithReader(readerA))))
+
+	readerB := metric.NewManualReader()
+	instrumenterB := New(WithMeterProvider(metric.NewMeterProvider(metric.WithReader(readerB))))
+
+	if err := instrumenterA.Instrument(mustCreateLRUCache(), "cache_a"); err != nil {
+		t.Fatalf("Failed to instrument cache_a: %v", err)
+	}
+
+	// The same name can be used by another Instrumenter
+	if err := instrumenterB.Instrument(mustCreateSyncedCache(), "cache_a"); err != nil {
+		t.Fatalf("Failed to instrument cache_a with the second instrumenter: %v", err)
+	}
+	if err := instrumenterB.Instrument(mustCreateShardedCache(), "cache_b"); err != nil {
+		t.Fatalf("Failed to instrument cache_b: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		reader         metric.Reader
+		expectedCaches []string
+	}{
+		{name: "A", reader: readerA, expectedCaches: []string{"cache_a"}},
+		{name: "B", reader: readerB, expectedCaches: []string{"cache_a", "cache_b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rm := collectMetrics(t, tc.reader)
+
+			hitMetric := findMetric(rm, "cache.hit")
+			if hitMetric == nil {
+				t.Fatal("cache.hit metric not found")
+			}
+			dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+
+			if len(dps) != len(tc.expectedCaches) {
+				t.Errorf("Expected %d data points, got %d", len(tc.expectedCaches), len(dps))
+			}
+			for _, cacheName := range tc.expectedCaches {
+				if _, ok := findDataPoint(dps, cacheName); !ok {
+					t.Errorf("Expected data point for %s", cacheName)
+				}
+			}
+		})
+	}
+}
+
+func TestInstrumenterOptions(t *testing.T) {
+	reader := metric.NewManualReader()
+	instrumenter := New(
+		WithMeterProvider(metric.NewMeterProvider(metric.WithReader(reader))),
+		WithAttributes(attribute.String("service", "checkout")),
+	)
+
+	// Options passed to Instrument extend the ones given to New
+	err := instrumenter.Instrument(mustCreateLRUCache(), "options",
+		WithAttributes(attribute.String("region", "eu-west-1")))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+
+	dp, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "options")
+	if !ok {
+		t.Fatal("No data point found for options cache")
+	}
+	for key, expected := range map[string]string{"service": "checkout", "region": "eu-west-1"} {
+		if got, _ := dp.Attributes.Value(attribute.Key(key)); got.AsString() != expected {
+			t.Errorf("Expected attribute %s=%s, got %s", key, expected, got.AsString())
+		}
+	}
+
+	// The default Instrumenter doesn't see caches of other Instrumenters
+	resetForTesting()
+	if names := InstrumentedCaches(); len(names) != 0 {
+		t.Errorf("Expected no caches in the default instrumenter, got %v", names)
+	}
+}
+
+func TestResetForTestingRegistersAgain(t *testing.T) {
+	resetForTesting()
+
+	provider := metric.NewMeterProvider(metric.WithReader(metric.NewManualReader()))
+	if err := InstrumentCache(mustCreateLRUCache(), "reset", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if RegisteredInstruments(provider) == nil {
+		t.Fatal("Expected instruments to be registered")
+	}
+
+	resetForTesting()
+
+	if RegisteredInstruments(provider) != nil {
+		t.Error("Expected no registered instruments after reset")
+	}
+
+	reader := metric.NewManualReader()
+	provider = metric.NewMeterProvider(metric.WithReader(reader))
+
+	// The name is free again and metrics are registered with the new provider
+	if err := InstrumentCache(mustCreateLRUCache(), "reset", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache after reset: %v", err)
+	}
+	if RegisteredInstruments(provider) == nil {
+		t.Error("Expected instruments to be registered again after reset")
+	}
+
+	rm := collectMetrics(t, reader)
+	if findMetric(rm, "cache.hit") == nil {
+		t.Error("cache.hit metric not found after reset")
+	}
+}
+
+func TestInstrumenterShutdown(t *testing.T) {
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	instrumenter := New(WithMeterProvider(provider))
+	if err := instrumenter.Instrument(mustCreateLRUCache(), "shutdown"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	if err := instrumenter.Shutdown(); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+
+	if names := instrumenter.InstrumentedCaches(); len(names) != 0 {
+		t.Errorf("Expected no instrumented caches after shutdown, got %v", names)
+	}
+
+	rm := collectMetrics(t, reader)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if dps, ok := m.Data.(metricdata.Sum[int64]); ok && len(dps.DataPoints) > 0 {
+				t.Errorf("Expected no %s data points after shutdown, got %d", m.Name, len(dps.DataPoints))
+			}
+		}
+	}
+
+	// The instrumenter registers the metrics anew when used again
+	if err := instrumenter.Instrument(mustCreateLRUCache(), "shutdown"); err != nil {
+		t.Fatalf("Failed to instrument cache after shutdown: %v", err)
+	}
+	rm = collectMetrics(t, reader)
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found after instrumenting again")
+	}
+	if _, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "shutdown"); !ok {
+		t.Error("Expected data point after instrumenting again")
+	}
+}
+
+func TestEmbeddersRegisterIndependently(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// A library embedding the package uses its own Instrumenter and scope, while its consumer uses
+	// the package-level functions, both with the same provider
+	library := New(WithMeterProvider(provider), WithMeterName("example.com/library"))
+	if err := library.Instrument(mustCreateLRUCache(), "library_cache"); err != nil {
+		t.Fatalf("Failed to instrument library cache: %v", err)
+	}
+	if err := InstrumentCache(mustCreateSyncedCache(), "consumer_cache", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument consumer cache: %v", err)
+	}
+
+	if library.RegisteredInstruments(provider) == nil {
+		t.Error("Expected the library to have its instruments registered")
+	}
+	if RegisteredInstruments(provider) == nil {
+		t.Error("Expected the consumer to have its instruments registered")
+	}
+
+	rm := collectMetrics(t, reader)
+	expected := map[string]string{
+		"example.com/library": "library_cache",
+		defaultMeterName:      "consumer_cache",
+	}
+	if len(rm.ScopeMetrics) != len(expected) {
+		t.Fatalf("Expected %d scopes, got %d", len(expected), len(rm.ScopeMetrics))
+	}
+	for _, sm := range rm.ScopeMetrics {
+		cacheName, ok := expected[sm.Scope.Name]
+		if !ok {
+			t.Errorf("Unexpected scope %s", sm.Scope.Name)
+			continue
+		}
+		for _, m := range sm.Metrics {
+			if m.Name != "cache.hit" {
+				continue
+			}
+			dps := m.Data.(metricdata.Sum[int64]).DataPoints
+			if len(dps) != 1 {
+				t.Errorf("Scope %s: expected 1 data point, got %d", sm.Scope.Name, len(dps))
+			}
+			if _, ok := findDataPoint(dps, cacheName); !ok {
+				t.Errorf("Scope %s: expected data point for %s", sm.Scope.Name, cacheName)
+			}
+		}
+	}
+}
+
+func TestMetricsRegistered(t *testing.T) {
+	// Reset global state for test isolation
+	resetForTesting()
+
+	if MetricsRegistered() {
+		t.Fatal("Expected no metrics to be registered before instrumenting a cache")
+	}
+
+	provider := metric.NewMeterProvider(metric.WithReader(metric.NewManualReader()))
+	if err := InstrumentCache(mustCreateLRUCache(), "registered", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if !MetricsRegistered() {
+		t.Error("Expected metrics to be registered after instrumenting a cache")
+	}
+
+	if err := Shutdown(); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+	if MetricsRegistered() {
+		t.Error("Expected no metrics to be registered after shutdown")
+	}
+}
+
+func TestInstrumentersHaveIndependentContents(t *testing.T) {
+	first := New()
+	second := New()
+
+	if err := first.Instrument(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 1}}, "shared"); err != nil {
+		t.Fatalf("Failed to instrument cache with the first instrumenter: %v", err)
+	}
+	if err := second.Instrument(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 2}}, "shared"); err != nil {
+		t.Fatalf("Failed to instrument cache with the second instrumenter: %v", err)
+	}
+	if err := second.Instrument(&metricsOnlyCache{}, "second_only"); err != nil {
+		t.Fatalf("Failed to instrument cache with the second instrumenter: %v", err)
+	}
+
+	if snapshot, _ := first.Snapshot("shared"); snapshot.Hits != 1 {
+		t.Errorf("Expected 1 hit in the first instrumenter, got %d", snapshot.Hits)
+	}
+	if snapshot, _ := second.Snapshot("shared"); snapshot.Hits != 2 {
+		t.Errorf("Expected 2 hits in the second instrumenter, got %d", snapshot.Hits)
+	}
+	if _, ok := first.Snapshot("second_only"); ok {
+		t.Error("Expected the first instrumenter not to see the caches of the second")
+	}
+
+	// Changes to one instrumenter leave the other untouched
+	if err := first.Uninstrument("shared"); err != nil {
+		t.Fatalf("Failed to uninstrument cache: %v", err)
+	}
+	if names := first.InstrumentedCaches(); len(names) != 0 {
+		t.Errorf("Expected no caches in the first instrumenter, got %v", names)
+	}
+	if names := second.InstrumentedCaches(); len(names) != 2 {
+		t.Errorf("Expected 2 caches in the second instrumenter, got %v", names)
+	}
+}
+
+func TestInstrumentWarnsBeyondCardinalityThreshold(t *testing.T) {
+	handler := &recordingHandler{}
+	provider := metric.NewMeterProvider(metric.WithReader(metric.NewManualReader()))
+	instrumenter := New(WithMeterProvider(provider), WithLogger(slog.New(handler)), WithCardinalityWarn(2))
+
+	for i, name := range []string{"first", "second", "third", "fourth"} {
+		if err := instrumenter.Instrument(mustCreateLRUCache(), name); err != nil {
+			t.Fatalf("Failed to instrument %s: %v", name, err)
+		}
+
+		// Only the caches registered beyond the threshold are reported
+		want := max(0, i+1-2)
+		if n := handler.count(slog.LevelWarn); n != want {
+			t.Errorf("Expected %d warnings after instrumenting %s, got %d", want, name, n)
+		}
+	}
+
+	if err := New(WithCardinalityWarn(0)).Instrument(mustCreateLRUCache(), "zero"); err == nil {
+		t.Error("Expected error for a non-positive threshold")
+	}
+}
+
+func TestSnapshotsSkipPanickingCache(t *testing.T) {
+	recorder := &errorRecorder{}
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(recorder)
+	defer otel.SetErrorHandler(previous)
+
+	plan := WithCacheAttributes(attribute.String("plan", "pro"))
+	instrumenter := New(WithMeterProvider(metric.NewMeterProvider()))
+	if err := instrumenter.Instrument(&panickingCache{}, "broken", plan); err != nil {
+		t.Fatalf("Failed to instrument broken cache: %v", err)
+	}
+	if err := instrumenter.Instrument(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 4}}, "healthy", plan); err != nil {
+		t.Fatalf("Failed to instrument healthy cache: %v", err)
+	}
+
+	if _, ok := instrumenter.Snapshot("broken"); ok {
+		t.Error("Expected no snapshot of the panicking cache")
+	}
+	if snapshots := instrumenter.Snapshots(); len(snapshots) != 1 || snapshots["healthy"].Hits != 4 {
+		t.Errorf("Expected only the healthy cache, got %v", snapshots)
+	}
+	if stats := instrumenter.AggregateStats(); stats.Caches != 1 || stats.Hits != 4 {
+		t.Errorf("Expected stats of the healthy cache only, got %+v", stats)
+	}
+	if groups := instrumenter.AggregateByAttribute("plan"); groups["pro"].Caches != 1 {
+		t.Errorf("Expected the pro group to hold the healthy cache only, got %+v", groups)
+	}
+
+	// A scrape doesn't crash either
+	rec := httptest.NewRecorder()
+	instrumenter.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+
+	if len(recorder.errs) == 0 {
+		t.Error("Expected the panics to be reported")
+	}
+}
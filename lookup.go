@@ -0,0 +1,81 @@
+package freelruotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// lookupResultKey is the attribute key telling hits and misses apart on cache.lookup.
+const lookupResultKey = AttributeResult
+
+// LookupRecorder records individual lookups on a synchronous "cache.lookup" counter. Unlike the
+// observable counters, which are collected without a request context, it can attach attributes
+// taken from the context of each lookup, like the baggage members selected with WithBaggageKeys.
+type LookupRecorder struct {
+	cfg *config
+
+	// counter is nil if cache.lookup is disabled with WithDisabledMetrics
+	counter metric.Int64Counter
+}
+
+// NewLookupRecorder creates a LookupRecorder with the MeterProvider, metric prefix, attributes and
+// baggage keys set by opts. If cache.lookup is disabled with WithDisabledMetrics, the recorder
+// records nothing.
+func NewLookupRecorder(opts ...Option) (*LookupRecorder, error) {
+	cfg := newConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	if cfg.disabled[MetricCacheLookup] {
+		return &LookupRecorder{cfg: cfg}, nil
+	}
+
+	meter := cfg.meter()
+	if meter == nil {
+		return nil, errNilMeter
+	}
+	counter, err := meter.Int64Counter(cfg.metricName(MetricCacheLookup),
+		metric.WithDescription(cfg.description(MetricCacheLookup)),
+		metric.WithUnit(cfg.unit(MetricCacheLookup)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LookupRecorder{cfg: cfg, counter: counter}, nil
+}
+
+// Record counts a lookup in the cache with the given name as a hit or a miss, with the
+// attributes of r and the promoted baggage members of ctx.
+func (r *LookupRecorder) Record(ctx context.Context, name string, hit bool) {
+	if r.counter == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	kvs := make([]attribute.KeyValue, 0, len(r.cfg.attributes)+len(r.cfg.baggageKeys)+3)
+	kvs = append(kvs, r.cfg.attributes...)
+	if len(r.cfg.baggageKeys) > 0 {
+		bag := baggage.FromContext(ctx)
+		for _, key := range r.cfg.baggageKeys {
+			if member := bag.Member(key); member.Key() != "" {
+				kvs = append(kvs, attribute.String(key, member.Value()))
+			}
+		}
+	}
+	// The namespace, result and cache name go last, as the last value of a duplicate key wins
+	kvs = r.cfg.appendNamespace(kvs)
+	kvs = append(kvs,
+		attribute.String(lookupResultKey, result),
+		attribute.String(r.cfg.cacheNameKey, r.cfg.reportedName(name)))
+
+	r.counter.Add(ctx, 1, metric.WithAttributes(kvs...))
+}
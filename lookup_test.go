@@ -0,0 +1,84 @@
+package freelruotel
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestLookupRecorderPromotesBaggage(t *testing.T) {
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	recorder, err := NewLookupRecorder(WithMeterProvider(provider), WithBaggageKeys("tenant", "region"))
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+
+	tenant, err := baggage.NewMember("tenant", "acme")
+	if err != nil {
+		t.Fatalf("Failed to create baggage member: %v", err)
+	}
+	user, err := baggage.NewMember("user", "42")
+	if err != nil {
+		t.Fatalf("Failed to create baggage member: %v", err)
+	}
+	bag, err := baggage.New(tenant, user)
+	if err != nil {
+		t.Fatalf("Failed to create baggage: %v", err)
+	}
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	recorder.Record(ctx, "sessions", true)
+	recorder.Record(ctx, "sessions", true)
+	recorder.Record(ctx, "sessions", false)
+
+	rm := collectMetrics(t, reader)
+
+	lookupMetric := findMetric(rm, "cache.lookup")
+	if lookupMetric == nil {
+		t.Fatal("cache.lookup metric not found")
+	}
+	dps := lookupMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if len(dps) != 2 {
+		t.Fatalf("Expected hit and miss data points, got %d", len(dps))
+	}
+
+	for _, dp := range dps {
+		if got, ok := dp.Attributes.Value("tenant"); !ok || got.AsString() != "acme" {
+			t.Errorf("Expected promoted attribute tenant=acme, got %v", got.Emit())
+		}
+		if _, ok := dp.Attributes.Value("user"); ok {
+			t.Error("Expected baggage member user not to be promoted")
+		}
+		if _, ok := dp.Attributes.Value("region"); ok {
+			t.Error("Expected missing baggage member region to be left out")
+		}
+
+		result, _ := dp.Attributes.Value(lookupResultKey)
+		expected := map[string]int64{"hit": 2, "miss": 1}[result.AsString()]
+		if dp.Value != expected {
+			t.Errorf("Expected %d lookups with result %s, got %d", expected, result.AsString(), dp.Value)
+		}
+	}
+}
+
+func TestLookupRecorderDisabled(t *testing.T) {
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	recorder, err := NewLookupRecorder(WithMeterProvider(provider), WithDisabledMetrics(MetricCacheLookup))
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	recorder.Record(context.Background(), "sessions", true)
+
+	if findMetric(collectMetrics(t, reader), "cache.lookup") != nil {
+		t.Error("Expected no cache.lookup metric while it's disabled")
+	}
+}
@@ -0,0 +1,49 @@
+package freelruotel
+
+// Unprefixed names of the metrics, e.g. for Views, alerting rules or options like WithDisabledMetrics.
+// The registered instrument names include the prefix set with WithMetricPrefix and the renames of
+// options like WithCollisionMetricName.
+const (
+	MetricCacheHit       = "cache.hit"
+	MetricCacheMiss      = "cache.miss"
+	MetricCacheInsert    = "cache.insert"
+	MetricCacheEviction  = "cache.eviction"
+	MetricCacheCollision = "cache.collision"
+	MetricCacheRemoval   = "cache.removal"
+	MetricCachePurge     = "cache.purge"
+
+	MetricCacheSize     = "cache.size"
+	MetricCacheCapacity = "cache.capacity"
+	MetricCacheLoad     = "cache.load"
+	MetricCacheShards   = "cache.shards"
+	MetricCacheExpired  = "cache.expired"
+
+	MetricCacheHitRatio      = "cache.hit_ratio"
+	MetricCacheCollisionRate = "cache.collision_rate"
+	MetricCacheLastObserved  = "cache.last_observed"
+	MetricCacheNetEntries    = "cache.net_entries"
+
+	MetricCacheLookup              = "cache.lookup"
+	MetricCacheCapacityUtilization = "cache.capacity_utilization"
+	MetricCacheWarmupDuration      = "cache.warmup.duration"
+	MetricCacheWarmupSize          = "cache.warmup.size"
+
+	MetricCacheRegistered       = "cache.registered"
+	MetricCacheRegistryHealthy  = "cache.registry.healthy"
+	MetricCacheInstrumentErrors = "cache.instrument.errors"
+)
+
+// DefaultScopeName is the default name of the instrumentation scope of the metrics, e.g. for Views
+// selecting them. WithMeterName registers the metrics under another scope.
+const DefaultScopeName = modulePath
+
+// Keys of the attributes set by the instrumentation itself, e.g. for Views keeping them. WithCacheNameKey
+// reports the cache name under another key.
+const (
+	AttributeCacheName  = "cache_name"
+	AttributeCacheType  = "cache_type"
+	AttributeNamespace  = "namespace"
+	AttributeDeployment = "deployment"
+	AttributeErrorType  = "error.type"
+	AttributeResult     = "result"
+)
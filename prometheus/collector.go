@@ -0,0 +1,84 @@
+// Package prometheus exposes the metrics of instrumented freelru caches as a prometheus.Collector,
+// for applications that use the Prometheus client directly instead of an OpenTelemetry pipeline.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/elastic/go-freelru"
+	"github.com/prometheus/client_golang/prometheus"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+)
+
+// cacheNameLabel is the label identifying the cache on every sample.
+const cacheNameLabel = "cache_name"
+
+// counterDesc is a counter exposed by the Collector and the function reading its value
+type counterDesc struct {
+	desc  *prometheus.Desc
+	value func(freelru.Metrics) uint64
+}
+
+// Collector is a prometheus.Collector reporting the counters of instrumented caches.
+type Collector struct {
+	instrumenter *freelruotel.Instrumenter
+	counters     []counterDesc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector for the caches instrumented by i. A nil Instrumenter
+// reports the caches instrumented with the package-level functions of freelruotel.
+func NewCollector(i *freelruotel.Instrumenter) *Collector {
+	newDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, []string{cacheNameLabel}, nil)
+	}
+
+	return &Collector{
+		instrumenter: i,
+		counters: []counterDesc{
+			{newDesc("cache_hits_total", "Number of cache hits"), func(m freelru.Metrics) uint64 { return m.Hits }},
+			{newDesc("cache_misses_total", "Number of cache misses"), func(m freelru.Metrics) uint64 { return m.Misses }},
+			{newDesc("cache_inserts_total", "Number of cache inserts"), func(m freelru.Metrics) uint64 { return m.Inserts }},
+			{newDesc("cache_evictions_total", "Number of entries evicted to make room for new ones"), func(m freelru.Metrics) uint64 { return m.Evictions }},
+			{newDesc("cache_collisions_total", "Number of hash collisions in the open-addressing table of the cache"), func(m freelru.Metrics) uint64 { return m.Collisions }},
+			{newDesc("cache_removals_total", "Number of entries removed explicitly or because they expired"), func(m freelru.Metrics) uint64 { return m.Removals }},
+		},
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.counters {
+		ch <- counter.desc
+	}
+}
+
+// Collect implements prometheus.Collector. It reads the metrics of every cache once.
+// The counters carry the time the cache was instrumented as their created timestamp,
+// which handlers exposing OpenMetrics report as _created series.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	snapshots, created := c.snapshots()
+	for name, metrics := range snapshots {
+		createdAt, ok := created[name]
+		for _, counter := range c.counters {
+			value := float64(counter.value(metrics))
+			if !ok {
+				// The cache was instrumented between reading the metrics and the created times
+				ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, value, name)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(counter.desc, prometheus.CounterValue,
+				value, createdAt, name)
+		}
+	}
+}
+
+// snapshots returns the current metrics of every cache and the times they were instrumented,
+// keyed by cache name
+func (c *Collector) snapshots() (map[string]freelru.Metrics, map[string]time.Time) {
+	if c.instrumenter == nil {
+		return freelruotel.Snapshots(), freelruotel.CreatedTimes()
+	}
+	return c.instrumenter.Snapshots(), c.instrumenter.CreatedTimes()
+}
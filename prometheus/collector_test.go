@@ -0,0 +1,109 @@
+package prometheus
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/elastic/go-freelru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+)
+
+func hashStringXXHASH(s string) uint32 {
+	return uint32(xxhash.Sum64String(s))
+}
+
+func TestCollector(t *testing.T) {
+	cache, err := freelru.New[string, string](10, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	instrumenter := freelruotel.New()
+	if err := instrumenter.Instrument(cache, "prom_cache"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	cache.Add("key", "value")
+	cache.Get("key")     // hit
+	cache.Get("missing") // miss
+
+	expected := `
+# HELP cache_hits_total Number of cache hits
+# TYPE cache_hits_total counter
+cache_hits_total{cache_name="prom_cache"} 1
+# HELP cache_inserts_total Number of cache inserts
+# TYPE cache_inserts_total counter
+cache_inserts_total{cache_name="prom_cache"} 1
+# HELP cache_misses_total Number of cache misses
+# TYPE cache_misses_total counter
+cache_misses_total{cache_name="prom_cache"} 1
+`
+
+	collector := NewCollector(instrumenter)
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"cache_hits_total", "cache_misses_total", "cache_inserts_total")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if count := testutil.CollectAndCount(collector); count != 6 {
+		t.Errorf("Expected 6 samples, got %d", count)
+	}
+
+	if problems, err := testutil.CollectAndLint(collector); err != nil || len(problems) > 0 {
+		t.Errorf("Expected no lint problems, got %v (%v)", problems, err)
+	}
+}
+
+func TestCollectorCreatedTimestamps(t *testing.T) {
+	cache, err := freelru.New[string, string](10, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	instrumenter := freelruotel.New()
+	if err := instrumenter.Instrument(cache, "prom_cache"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(instrumenter))
+
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: true,
+	})
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// OpenMetrics reports the created timestamp of cache_hits_total as cache_hits_created
+	const prefix = `cache_hits_created{cache_name="prom_cache"} `
+	var line string
+	for _, l := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(l, prefix) {
+			line = l
+		}
+	}
+	if line == "" {
+		t.Fatalf("Expected a _created series for cache_hits_total, got:\n%s", rec.Body.String())
+	}
+
+	got, err := strconv.ParseFloat(strings.TrimPrefix(line, prefix), 64)
+	if err != nil {
+		t.Fatalf("Failed to parse created timestamp: %v", err)
+	}
+	created := instrumenter.CreatedTimes()["prom_cache"]
+	if want := float64(created.UnixNano()) / 1e9; math.Abs(got-want) > 1e-3 {
+		t.Errorf("Expected created timestamp %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,91 @@
+// Package push periodically collects the metrics of a reader and hands them to an exporter,
+// for push-based pipelines that need cache metrics observed at a predictable cadence.
+//
+// The SDK's PeriodicReader covers the same need when the reader can be chosen freely;
+// this package drives an existing reader, e.g. a ManualReader shared with other code.
+package push
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// ticker abstracts time.Ticker so tests can drive the loop
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// timeTicker is the ticker backed by time.Ticker
+type timeTicker struct {
+	*time.Ticker
+}
+
+func (t timeTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// newTicker creates the ticker driving the loop, replaced in tests
+var newTicker = func(d time.Duration) ticker {
+	return timeTicker{time.NewTicker(d)}
+}
+
+// Start collects reader every interval in a new goroutine and exports the result with exporter.
+// Collection and export errors are passed to the global OpenTelemetry error handler.
+//
+// The returned stop function ends the loop, exports a final collection and returns its error.
+// It doesn't shut down the exporter.
+func Start(reader sdkmetric.Reader, exporter sdkmetric.Exporter, interval time.Duration) (stop func(context.Context) error, err error) {
+	if interval <= 0 {
+		return nil, errors.New("push interval must be positive")
+	}
+
+	t := newTicker(interval)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C():
+				if err := push(context.Background(), reader, exporter); err != nil {
+					otel.Handle(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop = func(ctx context.Context) error {
+		err := errors.New("push loop already stopped")
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			err = push(ctx, reader, exporter)
+		})
+		return err
+	}
+
+	return stop, nil
+}
+
+// push collects reader once and exports the result
+func push(ctx context.Context, reader sdkmetric.Reader, exporter sdkmetric.Exporter) error {
+	rm := &metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, rm); err != nil {
+		return err
+	}
+	return exporter.Export(ctx, rm)
+}
@@ -0,0 +1,106 @@
+package push
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/elastic/go-freelru"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func hashStringXXHASH(s string) uint32 {
+	return uint32(xxhash.Sum64String(s))
+}
+
+// fakeTicker is a ticker fired manually by the test
+type fakeTicker struct {
+	c chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {}
+
+// recordingExporter passes the hits of every exported collection to a channel
+type recordingExporter struct {
+	hits chan int64
+}
+
+func (e *recordingExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e *recordingExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e *recordingExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == "cache.hit" {
+				e.hits <- m.Data.(metricdata.Sum[int64]).DataPoints[0].Value
+			}
+		}
+	}
+	return nil
+}
+
+func (e *recordingExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *recordingExporter) Shutdown(context.Context) error { return nil }
+
+func TestStart(t *testing.T) {
+	fake := &fakeTicker{c: make(chan time.Time)}
+	newTicker = func(time.Duration) ticker { return fake }
+	defer func() {
+		newTicker = func(d time.Duration) ticker { return timeTicker{time.NewTicker(d)} }
+	}()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache, err := freelru.New[string, string](10, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := freelruotel.New().Instrument(cache, "pushed", freelruotel.WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	cache.Add("key", "value")
+
+	exporter := &recordingExporter{hits: make(chan int64, 1)}
+	stop, err := Start(reader, exporter, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to start push loop: %v", err)
+	}
+
+	for interval := int64(1); interval <= 2; interval++ {
+		cache.Get("key") // hit
+
+		fake.c <- time.Now()
+		if hits := <-exporter.hits; hits != interval {
+			t.Errorf("Interval %d: expected %d hits, got %d", interval, interval, hits)
+		}
+	}
+
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop push loop: %v", err)
+	}
+	if hits := <-exporter.hits; hits != 2 {
+		t.Errorf("Expected final export with 2 hits, got %d", hits)
+	}
+
+	if err := stop(context.Background()); err == nil {
+		t.Error("Expected error when stopping twice")
+	}
+
+	if _, err := Start(reader, exporter, 0); err == nil {
+		t.Error("Expected error for a non-positive interval")
+	}
+}
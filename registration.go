@@ -0,0 +1,846 @@
+package freelruotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// errorTypeKey is the attribute key telling the problems counted by cache.instrument.errors apart
+const errorTypeKey = AttributeErrorType
+
+// metricDefinition describes the defaults of a metric registered by registerAllMetrics
+type metricDefinition struct {
+	description string
+	unit        string
+}
+
+// metricDefinitions holds the definition of every metric, keyed by its unprefixed name
+var metricDefinitions = map[string]metricDefinition{
+	MetricCacheHit:       {description: "Number of cache hits", unit: "{hit}"},
+	MetricCacheMiss:      {description: "Number of cache misses", unit: "{miss}"},
+	MetricCacheInsert:    {description: "Number of cache inserts", unit: "{insert}"},
+	MetricCacheEviction:  {description: "Number of entries evicted to make room for new ones", unit: "{eviction}"},
+	MetricCacheCollision: {description: "Number of hash collisions in the open-addressing table of the cache", unit: "{collision}"},
+	MetricCacheRemoval:   {description: "Number of entries removed explicitly or because they expired", unit: "{removal}"},
+	MetricCachePurge:     {description: "Number of times the cache was purged, as recorded by RecordPurge", unit: "{purge}"},
+	MetricCacheSize:      {description: "Number of entries currently stored in the cache", unit: "{entry}"},
+	MetricCacheCapacity:  {description: "Maximum number of entries the cache can hold", unit: "{entry}"},
+	MetricCacheHitRatio:  {description: "Ratio of cache hits to total lookups", unit: "1"},
+	MetricCacheLoad:      {description: "Fraction of the capacity currently in use", unit: "1"},
+	MetricCacheShards:    {description: "Number of shards the cache is split into", unit: "{shard}"},
+	MetricCacheExpired:   {description: "Number of entries whose lifetime expired but weren't removed yet", unit: "{entry}"},
+	MetricCacheLookup:    {description: "Number of lookups recorded by a LookupRecorder", unit: "{lookup}"},
+	MetricCacheCapacityUtilization: {
+		description: "Distribution of the fraction of the capacity in use, sampled by a UtilizationSampler",
+		unit:        "1",
+	},
+	MetricCacheWarmupDuration: {description: "Duration of cache warmups run by WarmCache", unit: "s"},
+	MetricCacheWarmupSize:     {description: "Number of entries in the cache after its last warmup run by WarmCache", unit: "{entry}"},
+
+	// Metrics derived from the counters and the observations, in addition to cache.hit_ratio
+	MetricCacheCollisionRate: {description: "Ratio of hash collisions to inserts", unit: "1"},
+	MetricCacheLastObserved:  {description: "Unix time of the last successful observation of the cache", unit: "s"},
+	MetricCacheNetEntries:    {description: "Inserts minus removals and evictions, approximating the number of entries", unit: "{entry}"},
+
+	// Metrics not belonging to a single cache
+	MetricCacheRegistered:       {description: "Number of instrumented caches", unit: "{cache}"},
+	MetricCacheRegistryHealthy:  {description: "1 if the last collection observed every cache, 0 if any was skipped", unit: "1"},
+	MetricCacheInstrumentErrors: {description: "Number of problems observing the caches, by error.type", unit: "{error}"},
+}
+
+// counterFields lists every counter together with the freelru.Metrics field it reports
+var counterFields = []struct {
+	name  string
+	value func(freelru.Metrics) uint64
+}{
+	{MetricCacheHit, func(m freelru.Metrics) uint64 { return m.Hits }},
+	{MetricCacheMiss, func(m freelru.Metrics) uint64 { return m.Misses }},
+	{MetricCacheInsert, func(m freelru.Metrics) uint64 { return m.Inserts }},
+	{MetricCacheEviction, func(m freelru.Metrics) uint64 { return m.Evictions }},
+	{MetricCacheCollision, func(m freelru.Metrics) uint64 { return m.Collisions }},
+	{MetricCacheRemoval, func(m freelru.Metrics) uint64 { return m.Removals }},
+}
+
+// isCounter reports whether the metric with the given unprefixed name is registered by registerMetric
+func isCounter(name string) bool {
+	for _, field := range counterFields {
+		if field.name == name {
+			return true
+		}
+	}
+	return name == MetricCachePurge || name == MetricCacheInstrumentErrors
+}
+
+// counter is a registered counter and the function reading its value from a metrics snapshot
+type counter struct {
+	name     string
+	observer metric.Int64ObservableCounter
+	value    func(freelru.Metrics) uint64
+
+	// total reports the sum across all caches, nil unless aggregate metrics are enabled
+	total metric.Int64ObservableCounter
+}
+
+// registration holds the instruments registered with a meter and the config they were registered with.
+// Instruments of disabled metrics are nil.
+type registration struct {
+	cfg      *config
+	registry *cacheRegistry
+
+	// globalAttrs are the attributes of the metrics not belonging to a single cache
+	globalAttrs metric.MeasurementOption
+
+	// clampErrorAttrs, panicErrorAttrs and timeoutErrorAttrs are the attributes of
+	// cache.instrument.errors by error.type
+	clampErrorAttrs   metric.MeasurementOption
+	panicErrorAttrs   metric.MeasurementOption
+	timeoutErrorAttrs metric.MeasurementOption
+
+	// otherAttrs are the attributes of the series summing the caches beyond the limit of
+	// WithAttributeCardinalityLimit
+	otherAttrs metric.MeasurementOption
+
+	counters []counter
+	purge    metric.Int64ObservableCounter
+	size     metric.Int64Observable // a gauge, or an up-down counter with WithSizeAsUpDownCounter
+	capacity metric.Int64ObservableGauge
+	hitRatio metric.Float64ObservableGauge
+	collRate metric.Float64ObservableGauge
+	lastSeen metric.Float64ObservableGauge
+	netAdded metric.Int64ObservableGauge
+	load     metric.Float64ObservableGauge
+	expired  metric.Int64ObservableGauge
+	shards   metric.Int64ObservableGauge
+
+	registered metric.Int64ObservableGauge
+	healthy    metric.Int64ObservableGauge
+	errors     metric.Int64ObservableCounter
+
+	// aliases maps counters to their aliases set with WithMetricAlias
+	aliases map[metric.Int64Observable]metric.Int64Observable
+
+	// totals sums the counters across all caches for the aggregate metrics, nil unless they're enabled
+	totals *counterCarry
+
+	// other sums the counters of the caches beyond WithAttributeCardinalityLimit into the "_other"
+	// series, nil without a limit
+	other *counterCarry
+
+	// clampErrors, panicErrors and timeoutErrors count the problems reported by cache.instrument.errors
+	clampErrors   atomic.Uint64
+	panicErrors   atomic.Uint64
+	timeoutErrors atomic.Uint64
+
+	// callback unregisters the observe callback, nil if no instrument is enabled
+	callback metric.Registration
+
+	// clampOnce limits reporting of clamped counter values to the first occurrence
+	clampOnce sync.Once
+}
+
+// registerMetric creates the Int64ObservableCounter for the metric with the given unprefixed name
+func registerMetric(meter metric.Meter, cfg *config, name string) (metric.Int64ObservableCounter, error) {
+	return meter.Int64ObservableCounter(cfg.metricName(name),
+		metric.WithDescription(cfg.description(name)),
+		metric.WithUnit(cfg.unit(name)))
+}
+
+// dynamicObserver is a metric.Observer adding the attributes of WithDynamicAttributes to every
+// observation. The attributes of the observation win over dynamic attributes with the same key.
+type dynamicObserver struct {
+	metric.Observer
+	attrs metric.MeasurementOption
+}
+
+// ObserveInt64 implements metric.Observer.
+func (o dynamicObserver) ObserveInt64(obs metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	o.Observer.ObserveInt64(obs, value, append([]metric.ObserveOption{o.attrs}, opts...)...)
+}
+
+// ObserveFloat64 implements metric.Observer.
+func (o dynamicObserver) ObserveFloat64(obs metric.Float64Observable, value float64, opts ...metric.ObserveOption) {
+	o.Observer.ObserveFloat64(obs, value, append([]metric.ObserveOption{o.attrs}, opts...)...)
+}
+
+// registerFloat64Gauge creates the Float64ObservableGauge for the metric with the given unprefixed name
+func registerFloat64Gauge(meter metric.Meter, cfg *config, name string) (metric.Float64ObservableGauge, error) {
+	return meter.Float64ObservableGauge(cfg.metricName(name),
+		metric.WithDescription(cfg.description(name)),
+		metric.WithUnit(cfg.unit(name)))
+}
+
+// appendAlias creates the alias set with WithMetricAlias of the counter with the given unprefixed
+// name, if any, mirroring observer, and appends it to observables
+func (r *registration) appendAlias(meter metric.Meter, name string, observer metric.Int64ObservableCounter,
+	observables []metric.Observable) ([]metric.Observable, error) {
+	alias, ok := r.cfg.aliases[name]
+	if !ok {
+		return observables, nil
+	}
+	aliased, err := meter.Int64ObservableCounter(r.cfg.metricName(alias),
+		metric.WithDescription(r.cfg.description(name)),
+		metric.WithUnit(r.cfg.unit(name)))
+	if err != nil {
+		return nil, err
+	}
+	if r.aliases == nil {
+		r.aliases = make(map[metric.Int64Observable]metric.Int64Observable)
+	}
+	r.aliases[observer] = aliased
+	return append(observables, aliased), nil
+}
+
+// aliasObserver is a metric.Observer additionally observing the values of aliased counters
+// for their aliases
+type aliasObserver struct {
+	metric.Observer
+	aliases map[metric.Int64Observable]metric.Int64Observable
+}
+
+// ObserveInt64 implements metric.Observer.
+func (o aliasObserver) ObserveInt64(obs metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	o.Observer.ObserveInt64(obs, value, opts...)
+	if alias, ok := o.aliases[obs]; ok {
+		o.Observer.ObserveInt64(alias, value, opts...)
+	}
+}
+
+// registerAllMetrics registers all enabled cache metrics with the provided meter,
+// observing the caches of registry
+func registerAllMetrics(meter metric.Meter, cfg *config, registry *cacheRegistry) (*registration, error) {
+	reg := &registration{
+		cfg:         cfg,
+		registry:    registry,
+		globalAttrs: globalAttributes(cfg),
+
+		clampErrorAttrs: globalAttributes(cfg, attribute.String(errorTypeKey, "clamp")),
+		panicErrorAttrs: globalAttributes(cfg, attribute.String(errorTypeKey, "panic")),
+
+		timeoutErrorAttrs: globalAttributes(cfg, attribute.String(errorTypeKey, "timeout")),
+	}
+	if cfg.cardinality > 0 {
+		reg.otherAttrs = globalAttributes(cfg, attribute.String(cfg.cacheNameKey, otherCacheName))
+	}
+	var observables []metric.Observable
+
+	// Create observers for all enabled counters
+	for _, field := range counterFields {
+		if cfg.disabled[field.name] {
+			continue
+		}
+		observer, err := registerMetric(meter, cfg, field.name)
+		if err != nil {
+			return nil, err
+		}
+		c := counter{name: field.name, observer: observer, value: field.value}
+		observables = append(observables, observer)
+		if observables, err = reg.appendAlias(meter, field.name, observer, observables); err != nil {
+			return nil, err
+		}
+
+		if cfg.aggregate {
+			c.total, err = meter.Int64ObservableCounter(cfg.metricName(totalName(field.name)),
+				metric.WithDescription(cfg.description(field.name)+" across all caches"),
+				metric.WithUnit(cfg.unit(field.name)))
+			if err != nil {
+				return nil, err
+			}
+			observables = append(observables, c.total)
+		}
+		reg.counters = append(reg.counters, c)
+	}
+	if cfg.aggregate {
+		reg.totals = newCounterCarry(reg.counters)
+	}
+	if cfg.cardinality > 0 {
+		reg.other = newCounterCarry(reg.counters)
+	}
+
+	var err error
+	if !cfg.disabled[MetricCachePurge] {
+		reg.purge, err = registerMetric(meter, cfg, MetricCachePurge)
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.purge)
+		if observables, err = reg.appendAlias(meter, MetricCachePurge, reg.purge, observables); err != nil {
+			return nil, err
+		}
+	}
+
+	if !cfg.disabled[MetricCacheSize] {
+		if cfg.sizeAsUpDown {
+			reg.size, err = meter.Int64ObservableUpDownCounter(cfg.metricName(MetricCacheSize),
+				metric.WithDescription(cfg.description(MetricCacheSize)),
+				metric.WithUnit(cfg.unit(MetricCacheSize)))
+		} else {
+			reg.size, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheSize),
+				metric.WithDescription(cfg.description(MetricCacheSize)),
+				metric.WithUnit(cfg.unit(MetricCacheSize)))
+		}
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.size)
+	}
+
+	if !cfg.disabled[MetricCacheCapacity] {
+		reg.capacity, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheCapacity),
+			metric.WithDescription(cfg.description(MetricCacheCapacity)),
+			metric.WithUnit(cfg.unit(MetricCacheCapacity)))
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.capacity)
+	}
+
+	if !cfg.disabled[MetricCacheHitRatio] {
+		reg.hitRatio, err = registerFloat64Gauge(meter, cfg, MetricCacheHitRatio)
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.hitRatio)
+	}
+
+	if !cfg.disabled[MetricCacheCollisionRate] {
+		reg.collRate, err = registerFloat64Gauge(meter, cfg, MetricCacheCollisionRate)
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.collRate)
+	}
+
+	if !cfg.disabled[MetricCacheNetEntries] {
+		reg.netAdded, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheNetEntries),
+			metric.WithDescription(cfg.description(MetricCacheNetEntries)),
+			metric.WithUnit(cfg.unit(MetricCacheNetEntries)))
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.netAdded)
+	}
+
+	if !cfg.disabled[MetricCacheLastObserved] {
+		reg.lastSeen, err = registerFloat64Gauge(meter, cfg, MetricCacheLastObserved)
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.lastSeen)
+	}
+
+	if !cfg.disabled[MetricCacheLoad] {
+		reg.load, err = registerFloat64Gauge(meter, cfg, MetricCacheLoad)
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.load)
+	}
+
+	if !cfg.disabled[MetricCacheShards] {
+		reg.shards, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheShards),
+			metric.WithDescription(cfg.description(MetricCacheShards)),
+			metric.WithUnit(cfg.unit(MetricCacheShards)))
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.shards)
+	}
+
+	if !cfg.disabled[MetricCacheExpired] {
+		reg.expired, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheExpired),
+			metric.WithDescription(cfg.description(MetricCacheExpired)),
+			metric.WithUnit(cfg.unit(MetricCacheExpired)))
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.expired)
+	}
+
+	if !cfg.disabled[MetricCacheRegistered] {
+		reg.registered, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheRegistered),
+			metric.WithDescription(cfg.description(MetricCacheRegistered)),
+			metric.WithUnit(cfg.unit(MetricCacheRegistered)))
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.registered)
+	}
+
+	if !cfg.disabled[MetricCacheRegistryHealthy] {
+		reg.healthy, err = meter.Int64ObservableGauge(cfg.metricName(MetricCacheRegistryHealthy),
+			metric.WithDescription(cfg.description(MetricCacheRegistryHealthy)),
+			metric.WithUnit(cfg.unit(MetricCacheRegistryHealthy)))
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.healthy)
+	}
+
+	if !cfg.disabled[MetricCacheInstrumentErrors] {
+		reg.errors, err = registerMetric(meter, cfg, MetricCacheInstrumentErrors)
+		if err != nil {
+			return nil, err
+		}
+		observables = append(observables, reg.errors)
+		if observables, err = reg.appendAlias(meter, MetricCacheInstrumentErrors, reg.errors, observables); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(observables) == 0 {
+		return reg, nil
+	}
+
+	// Register single callback that observes all metrics at once
+	callback, err := meter.RegisterCallback(reg.observe, observables...)
+	if err != nil {
+		return nil, err
+	}
+	reg.callback = callback
+	cfg.log(context.Background(), slog.LevelDebug, "registered cache metrics",
+		slog.String("meter", cfg.meterName), slog.Int("instruments", len(observables)))
+
+	return reg, nil
+}
+
+// unregister stops the callback from observing the registry
+func (r *registration) unregister() error {
+	if r.callback == nil {
+		return nil
+	}
+	return r.callback.Unregister()
+}
+
+// observe reports the metrics of every cache in the registry. It stops early and returns
+// the context's error once ctx is done.
+func (r *registration) observe(ctx context.Context, o metric.Observer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.cfg.dynamicAttrs != nil {
+		// Called before iterating over the caches, so it's evaluated once per collection
+		kvs, err := r.dynamicAttributes()
+		if err != nil {
+			// Report the caches without the dynamic attributes rather than not at all
+			r.panicErrors.Add(1)
+			otel.Handle(fmt.Errorf("freelruotel: %w", err))
+			r.cfg.log(ctx, slog.LevelWarn, "observing caches without the dynamic attributes, which panicked",
+				slog.Any("error", err))
+		}
+		if len(kvs) > 0 {
+			o = dynamicObserver{Observer: o, attrs: metric.WithAttributes(kvs...)}
+		}
+	}
+	if r.aliases != nil {
+		o = aliasObserver{Observer: o, aliases: r.aliases}
+	}
+
+	if r.registered != nil {
+		o.ObserveInt64(r.registered, int64(r.registry.len()), r.globalAttrs)
+	}
+
+	// With a cardinality limit, caches beyond it are summed into the "_other" counters
+	var individual map[uint64]struct{}
+	var otherGen uint64
+	if r.other != nil {
+		individual = r.registry.oldest(r.cfg.cardinality)
+		otherGen = r.other.begin()
+	}
+
+	// The sums keep the last values of the caches that are skipped, so they don't drop meanwhile
+	var totalsGen uint64
+	if r.totals != nil {
+		totalsGen = r.totals.begin()
+	}
+	keep := func(entry *cacheEntry, overflowed bool) {
+		if r.totals != nil {
+			r.totals.keep(totalsGen, entry.id)
+		}
+		if overflowed {
+			r.other.keep(otherGen, entry.id)
+		}
+	}
+
+	// skipped tells whether a cache was skipped, or only partly observed, because reading it failed
+	var skipped bool
+	var err error
+	r.registry.forEachSorted(func(name string, entry *cacheEntry) bool {
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+		_, ok := individual[entry.id]
+		overflowed := individual != nil && !ok
+
+		if entry.disabled.Load() {
+			keep(entry, overflowed)
+			r.cfg.log(ctx, slog.LevelDebug, "skipping disabled cache", slog.String("cache", name))
+			return true
+		}
+		if r.cfg.nameFilter != nil {
+			accepted, filterErr := r.accepts(name)
+			if filterErr != nil {
+				// Skip the cache, as it can't be told whether it should be reported
+				keep(entry, overflowed)
+				skipped = true
+				r.reportPanic(ctx, name, filterErr)
+				return true
+			}
+			if !accepted {
+				keep(entry, overflowed)
+				r.cfg.log(ctx, slog.LevelDebug, "skipping filtered cache", slog.String("cache", name))
+				return true
+			}
+		}
+
+		metrics, readErr := entry.metrics(r.cfg.snapshotTTL, r.cfg.observeTimeout)
+		if readErr != nil && !overflowed {
+			// Keep reporting the last successful observation, so staleness can be alerted on
+			r.observeLastObserved(o, entry)
+		}
+		if readErr != nil {
+			keep(entry, overflowed)
+		}
+		if errors.Is(readErr, errObserveTimeout) {
+			// Skip the cache, so one stuck provider doesn't stall the others
+			r.timeoutErrors.Add(1)
+			skipped = true
+			r.cfg.log(ctx, slog.LevelWarn, "skipping cache whose Metrics timed out",
+				slog.String("cache", name), slog.Duration("timeout", r.cfg.observeTimeout))
+			return true
+		}
+		if readErr != nil {
+			// Skip the cache, so one broken provider doesn't stop the others from being reported
+			r.panicErrors.Add(1)
+			skipped = true
+			otel.Handle(fmt.Errorf("freelruotel: cache '%s': %w", name, readErr))
+			r.cfg.log(ctx, slog.LevelWarn, "skipping cache whose Metrics panicked",
+				slog.String("cache", name), slog.Any("error", readErr))
+			return true
+		}
+		entry.lastObserved.Store(now().UnixNano())
+		if r.totals != nil {
+			r.totals.update(totalsGen, entry.id, metrics, entry.purges.Load())
+		}
+		if overflowed {
+			r.other.update(otherGen, entry.id, metrics, entry.purges.Load())
+			return true
+		}
+		attrs := entry.observeOptions(r.cfg)
+
+		for _, c := range r.counters {
+			raw := c.value(metrics)
+			value, clamped := clampInt64(raw)
+			if clamped {
+				r.clampErrors.Add(1)
+				r.clampOnce.Do(func() {
+					otel.Handle(fmt.Errorf("freelruotel: %s of cache '%s' exceeds the int64 range, reporting %d",
+						c.name, name, value))
+					r.cfg.log(ctx, slog.LevelWarn, "counter exceeds the int64 range, clamping",
+						slog.String("cache", name), slog.String("metric", c.name), slog.Uint64("value", raw))
+				})
+			}
+			if value != 0 || !r.cfg.skipZero {
+				o.ObserveInt64(c.observer, value, attrs...)
+			}
+		}
+		if r.purge != nil {
+			if purges, _ := clampInt64(entry.purges.Load()); purges != 0 || !r.cfg.skipZero {
+				o.ObserveInt64(r.purge, purges, attrs...)
+			}
+		}
+		if r.hitRatio != nil {
+			o.ObserveFloat64(r.hitRatio, hitRatio(metrics), attrs...)
+		}
+		if r.collRate != nil {
+			o.ObserveFloat64(r.collRate, collisionRate(metrics), attrs...)
+		}
+		if r.netAdded != nil {
+			o.ObserveInt64(r.netAdded, netEntries(metrics), attrs...)
+		}
+		r.observeLastObserved(o, entry)
+
+		if gaugeErr := r.observeGauges(o, entry, attrs); gaugeErr != nil {
+			// The gauges observed before the panic stay reported, the others are skipped
+			skipped = true
+			r.reportPanic(ctx, name, gaugeErr)
+		}
+		return true
+	})
+	if err != nil {
+		// Not every cache was visited, so none can be told to have left the sums
+		return err
+	}
+
+	// "_other" is reported from the first cache beyond the limit on, even once all of them are gone
+	if r.other != nil {
+		if overflow, ok := r.other.end(otherGen); ok {
+			for i, c := range r.counters {
+				if value, _ := clampInt64(overflow[i]); value != 0 || !r.cfg.skipZero {
+					o.ObserveInt64(c.observer, value, r.otherAttrs)
+				}
+			}
+			if r.purge != nil {
+				if purges, _ := clampInt64(overflow[len(r.counters)]); purges != 0 || !r.cfg.skipZero {
+					o.ObserveInt64(r.purge, purges, r.otherAttrs)
+				}
+			}
+		}
+	}
+
+	if r.errors != nil {
+		clampErrors, _ := clampInt64(r.clampErrors.Load())
+		panicErrors, _ := clampInt64(r.panicErrors.Load())
+		o.ObserveInt64(r.errors, clampErrors, r.clampErrorAttrs)
+		o.ObserveInt64(r.errors, panicErrors, r.panicErrorAttrs)
+		if r.cfg.observeTimeout > 0 {
+			timeoutErrors, _ := clampInt64(r.timeoutErrors.Load())
+			o.ObserveInt64(r.errors, timeoutErrors, r.timeoutErrorAttrs)
+		}
+	}
+	if r.healthy != nil {
+		var healthy int64
+		if !skipped {
+			healthy = 1
+		}
+		o.ObserveInt64(r.healthy, healthy, r.globalAttrs)
+	}
+	if r.totals == nil {
+		return nil
+	}
+
+	// Totals carry the global attributes only, as they don't belong to a single cache
+	totals, _ := r.totals.end(totalsGen)
+	attrs := r.globalAttrs
+	for i, c := range r.counters {
+		if value, _ := clampInt64(totals[i]); value != 0 || !r.cfg.skipZero {
+			o.ObserveInt64(c.total, value, attrs)
+		}
+	}
+	return nil
+}
+
+// observeGauges reports the gauges of entry read from the optional interfaces of its cache and the
+// WithExpiredFunc callback. These run user code, so a panic is recovered and returned as an error.
+func (r *registration) observeGauges(o metric.Observer, entry *cacheEntry, attrs []metric.ObserveOption) (err error) {
+	// call names the user code being run, for the error of a panic
+	var call string
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic in %s: %v", call, p)
+		}
+	}()
+
+	// Size, capacity and load are only reported for freelru caches and caches implementing the
+	// optional interfaces
+	cache := entry.cache
+	sizer, hasSize := cache.(SizeProvider)
+	if hasSize && r.size != nil {
+		call = "Len"
+		o.ObserveInt64(r.size, int64(sizer.Len()), attrs...)
+	}
+	call = "Cap"
+	capacity, hasCap := entry.capacityOf()
+	if hasCap && r.capacity != nil {
+		o.ObserveInt64(r.capacity, int64(capacity), attrs...)
+	}
+	if hasSize && hasCap && r.load != nil {
+		call = "Len"
+		o.ObserveFloat64(r.load, load(sizer.Len(), capacity), attrs...)
+	}
+	if r.shards != nil {
+		// ShardsProvider takes precedence over the shards detected for freelru caches
+		if sharder, ok := cache.(ShardsProvider); ok {
+			call = "Shards"
+			o.ObserveInt64(r.shards, int64(sharder.Shards()), attrs...)
+		} else if entry.shards > 0 {
+			o.ObserveInt64(r.shards, int64(entry.shards), attrs...)
+		}
+	}
+	if entry.expired != nil && r.expired != nil {
+		call = "the expired func"
+		o.ObserveInt64(r.expired, int64(entry.expired()), attrs...)
+	}
+	return nil
+}
+
+// accepts calls the WithNameFilter predicate on name, recovering a panic as an error
+func (r *registration) accepts(name string) (accepted bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic in the name filter: %v", p)
+		}
+	}()
+	return r.cfg.nameFilter(name), nil
+}
+
+// dynamicAttributes calls the WithDynamicAttributes function, recovering a panic as an error
+func (r *registration) dynamicAttributes() (kvs []attribute.KeyValue, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic in the dynamic attributes: %v", p)
+		}
+	}()
+	return r.cfg.dynamicAttrs(), nil
+}
+
+// reportPanic counts a panic recovered from the user code observing the cache with the given name
+// under cache.instrument.errors and reports it to the OTel error handler
+func (r *registration) reportPanic(ctx context.Context, name string, err error) {
+	r.panicErrors.Add(1)
+	otel.Handle(fmt.Errorf("freelruotel: cache '%s': %w", name, err))
+	r.cfg.log(ctx, slog.LevelWarn, "recovered a panic observing cache",
+		slog.String("cache", name), slog.Any("error", err))
+}
+
+// observeLastObserved reports the time of the last successful observation of entry, if any
+func (r *registration) observeLastObserved(o metric.Observer, entry *cacheEntry) {
+	if r.lastSeen == nil {
+		return
+	}
+	if t := entry.lastObserved.Load(); t != 0 {
+		o.ObserveFloat64(r.lastSeen, float64(t)/float64(time.Second), entry.observeOptions(r.cfg)...)
+	}
+}
+
+// globalAttributes returns the attributes of the metrics not belonging to a single cache,
+// followed by extra
+func globalAttributes(cfg *config, extra ...attribute.KeyValue) metric.MeasurementOption {
+	kvs := make([]attribute.KeyValue, 0, len(cfg.attributes)+1+len(extra))
+	kvs = append(kvs, cfg.attributes...)
+	kvs = cfg.appendNamespace(kvs)
+	return metric.WithAttributeSet(attribute.NewSet(append(kvs, extra...)...))
+}
+
+// totalName returns the name of the aggregate counter of the counter with the given unprefixed name,
+// e.g. "cache.total.hit" for "cache.hit"
+func totalName(name string) string {
+	return "cache.total." + strings.TrimPrefix(name, "cache.")
+}
+
+// addSaturating returns a+b, or math.MaxUint64 if the sum would wrap around
+func addSaturating(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// errObserveTimeout is returned by readMetricsTimeout for caches not responding in time
+var errObserveTimeout = errors.New("timed out waiting for Metrics")
+
+// metricsResult is the outcome of a Metrics call run in its own goroutine
+type metricsResult struct {
+	metrics freelru.Metrics
+	err     error
+}
+
+// readMetricsTimeout returns the metrics of the cache of e like readMetrics, giving up with
+// errObserveTimeout after timeout. A non-positive timeout waits for Metrics to return.
+//
+// At most one call is in flight per entry: while a call that timed out hasn't returned yet, the cache
+// is skipped with errObserveTimeout right away, so a cache that never returns leaks a single goroutine
+// rather than one per collection. Unsynchronized freelru LRUs return without waiting for a lock, so
+// they're read without a goroutine and a timer.
+func (e *cacheEntry) readMetricsTimeout(timeout time.Duration) (freelru.Metrics, error) {
+	if timeout <= 0 || freelruTypeName(e.cache) == "LRU" {
+		return readMetrics(e.cache)
+	}
+
+	e.readMu.Lock()
+	defer e.readMu.Unlock()
+
+	if e.pending != nil {
+		select {
+		case <-e.pending:
+			// The call that timed out returned meanwhile, but its metrics may be outdated
+			e.pending = nil
+		default:
+			return freelru.Metrics{}, errObserveTimeout
+		}
+	}
+
+	// Buffered, so the goroutine of a cache that timed out doesn't block forever
+	results := make(chan metricsResult, 1)
+	go func() {
+		metrics, err := readMetrics(e.cache)
+		results <- metricsResult{metrics, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.metrics, r.err
+	case <-timer.C:
+		e.pending = results
+		return freelru.Metrics{}, errObserveTimeout
+	}
+}
+
+// readMetrics returns the metrics of cache, turning a panic in its Metrics method into an error
+func readMetrics(cache MetricsProvider) (metrics freelru.Metrics, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in Metrics: %v", r)
+		}
+	}()
+	return cache.Metrics(), nil
+}
+
+// clampInt64 converts v to int64, clamping values above math.MaxInt64 so that
+// counters never turn negative. It reports whether v was clamped.
+func clampInt64(v uint64) (int64, bool) {
+	if v > math.MaxInt64 {
+		return math.MaxInt64, true
+	}
+	return int64(v), false
+}
+
+// load returns size/capacity, or 0 for caches without capacity
+func load(size, capacity int) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	return float64(size) / float64(capacity)
+}
+
+// netEntries returns the inserts minus the removals and evictions, clamped to the int64 range
+// and to 0, as counters read from other sources may report more removals than inserts
+func netEntries(metrics freelru.Metrics) int64 {
+	removed := addSaturating(metrics.Removals, metrics.Evictions)
+	if metrics.Inserts <= removed {
+		return 0
+	}
+	net, _ := clampInt64(metrics.Inserts - removed)
+	return net
+}
+
+// collisionRate returns collisions/inserts, or 0 when nothing was inserted
+func collisionRate(metrics freelru.Metrics) float64 {
+	if metrics.Inserts == 0 {
+		return 0
+	}
+	return float64(metrics.Collisions) / float64(metrics.Inserts)
+}
+
+// hitRatio returns hits/(hits+misses), or 0 when the cache hasn't served any lookups
+func hitRatio(metrics freelru.Metrics) float64 {
+	// Sum as floats, as the uint64 sum could wrap around
+	lookups := float64(metrics.Hits) + float64(metrics.Misses)
+	if lookups == 0 {
+		return 0
+	}
+	return float64(metrics.Hits) / lookups
+}
@@ -0,0 +1,807 @@
+package freelruotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// countingObserver counts the observations made by a callback
+type countingObserver struct {
+	embedded.Observer
+	observations int
+}
+
+func (o *countingObserver) ObserveFloat64(metric.Float64Observable, float64, ...metric.ObserveOption) {
+	o.observations++
+}
+
+func (o *countingObserver) ObserveInt64(metric.Int64Observable, int64, ...metric.ObserveOption) {
+	o.observations++
+}
+
+// mustRegisterAllMetrics registers all metrics for registry with a fresh meter
+func mustRegisterAllMetrics(t *testing.T, cfg *config, registry *cacheRegistry) *registration {
+	t.Helper()
+
+	meter := sdkmetric.NewMeterProvider().Meter("test")
+	reg, err := registerAllMetrics(meter, cfg, registry)
+	if err != nil {
+		t.Fatalf("Failed to register metrics: %v", err)
+	}
+	return reg
+}
+
+func TestObserveCancelledContext(t *testing.T) {
+	registry := &cacheRegistry{}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := registry.add(&cacheEntry{cache: mustCreateLRUCache(), reportedName: name}, name); err != nil {
+			t.Fatalf("Failed to add cache: %v", err)
+		}
+	}
+	reg := mustRegisterAllMetrics(t, newConfig(), registry)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	o := &countingObserver{}
+	err := reg.observe(ctx, o)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if o.observations != 0 {
+		t.Errorf("Expected no observations, got %d", o.observations)
+	}
+
+	// The same registration observes every cache with a live context
+	o = &countingObserver{}
+	if err := reg.observe(context.Background(), o); err != nil {
+		t.Fatalf("Failed to observe: %v", err)
+	}
+	if o.observations == 0 {
+		t.Error("Expected observations with a live context")
+	}
+}
+
+// errorRecorder is an otel.ErrorHandler collecting the handled errors
+type errorRecorder struct {
+	errs []error
+}
+
+func (r *errorRecorder) Handle(err error) {
+	r.errs = append(r.errs, err)
+}
+
+func TestObserveClampsOverflowingCounters(t *testing.T) {
+	recorder := &errorRecorder{}
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(recorder)
+	defer otel.SetErrorHandler(previous)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: math.MaxInt64 + 1, Misses: math.MaxUint64, Inserts: 7}}
+	if err := New().Instrument(cache, "overflow", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rm := collectMetrics(t, reader)
+
+		for metricName, expected := range map[string]int64{"cache.hit": math.MaxInt64, "cache.miss": math.MaxInt64, "cache.insert": 7} {
+			m := findMetric(rm, metricName)
+			if m == nil {
+				t.Fatalf("%s metric not found", metricName)
+			}
+			dp, ok := findDataPoint(m.Data.(metricdata.Sum[int64]).DataPoints, "overflow")
+			if !ok {
+				t.Fatalf("No %s data point found", metricName)
+			}
+			if dp.Value != expected {
+				t.Errorf("Expected %s %d, got %d", metricName, expected, dp.Value)
+			}
+		}
+	}
+
+	if len(recorder.errs) != 1 {
+		t.Errorf("Expected clamping to be reported once, got %d reports", len(recorder.errs))
+	}
+}
+
+func TestHitRatioDoesNotOverflow(t *testing.T) {
+	ratio := hitRatio(freelru.Metrics{Hits: math.MaxUint64, Misses: math.MaxUint64})
+	if ratio != 0.5 {
+		t.Errorf("Expected hit ratio 0.5, got %v", ratio)
+	}
+}
+
+// recordingHandler is a slog.Handler collecting the handled records
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, record)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+// count returns the number of records handled at level
+func (h *recordingHandler) count(level slog.Level) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, record := range h.records {
+		if record.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+func TestObserveLogsClampedCounters(t *testing.T) {
+	handler := &recordingHandler{}
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: math.MaxUint64}}
+	err := New().Instrument(cache, "overflow", WithMeterProvider(provider), WithLogger(slog.New(handler)))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	if n := handler.count(slog.LevelDebug); n != 1 {
+		t.Errorf("Expected registration to be logged once, got %d debug records", n)
+	}
+
+	collectMetrics(t, reader)
+	collectMetrics(t, reader)
+
+	if n := handler.count(slog.LevelWarn); n != 1 {
+		t.Errorf("Expected clamping to be logged once, got %d warnings", n)
+	}
+}
+
+// panickingCache is a MetricsProvider whose Metrics method panics
+type panickingCache struct{}
+
+func (panickingCache) Metrics() freelru.Metrics {
+	panic("broken cache")
+}
+
+func TestObserveSkipsPanickingCache(t *testing.T) {
+	recorder := &errorRecorder{}
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(recorder)
+	defer otel.SetErrorHandler(previous)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	instrumenter := New(WithMeterProvider(provider))
+	if err := instrumenter.Instrument(&panickingCache{}, "broken"); err != nil {
+		t.Fatalf("Failed to instrument broken cache: %v", err)
+	}
+	if err := instrumenter.Instrument(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 4}}, "healthy"); err != nil {
+		t.Fatalf("Failed to instrument healthy cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if dp, ok := findDataPoint(dps, "healthy"); !ok || dp.Value != 4 {
+		t.Errorf("Expected healthy cache to report 4 hits, got %v (found %t)", dp.Value, ok)
+	}
+	if _, ok := findDataPoint(dps, "broken"); ok {
+		t.Error("Expected no data point for the panicking cache")
+	}
+	if len(recorder.errs) == 0 {
+		t.Error("Expected the panic to be reported")
+	}
+}
+
+// panickingShardsCache reports metrics but panics in Shards
+type panickingShardsCache struct {
+	metricsOnlyCache
+}
+
+func (panickingShardsCache) Shards() int {
+	panic("broken shards")
+}
+
+func TestObserveRecoversPanicsInUserCode(t *testing.T) {
+	recorder := &errorRecorder{}
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(recorder)
+	defer otel.SetErrorHandler(previous)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	instrumenter := New(WithMeterProvider(provider),
+		WithDynamicAttributes(func() []attribute.KeyValue { panic("broken attributes") }),
+		WithNameFilter(func(name string) bool {
+			if name == "filter_broken" {
+				panic("broken filter")
+			}
+			return true
+		}))
+	caches := []struct {
+		name  string
+		cache MetricsProvider
+		opts  []Option
+	}{
+		{name: "healthy", cache: &metricsOnlyCache{metrics: freelru.Metrics{Hits: 4}}},
+		{name: "size_broken", cache: &panickingSizeCache{metricsOnlyCache{metrics: freelru.Metrics{Hits: 1}}}},
+		{name: "shards_broken", cache: &panickingShardsCache{metricsOnlyCache{metrics: freelru.Metrics{Hits: 1}}}},
+		{
+			name:  "expired_broken",
+			cache: &metricsOnlyCache{metrics: freelru.Metrics{Hits: 1}},
+			opts:  []Option{WithExpiredFunc(func() int { panic("broken expired func") })},
+		},
+		{name: "filter_broken", cache: &metricsOnlyCache{metrics: freelru.Metrics{Hits: 1}}},
+	}
+	for _, c := range caches {
+		if err := instrumenter.Instrument(c.cache, c.name, c.opts...); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", c.name, err)
+		}
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if dp, ok := findDataPoint(dps, "healthy"); !ok || dp.Value != 4 {
+		t.Errorf("Expected healthy cache to report 4 hits, got %v (found %t)", dp.Value, ok)
+	}
+	// The counters are observed before the gauges whose user code panics
+	for _, name := range []string{"size_broken", "shards_broken", "expired_broken"} {
+		if _, ok := findDataPoint(dps, name); !ok {
+			t.Errorf("Expected the counters of %s to be reported", name)
+		}
+	}
+	if _, ok := findDataPoint(dps, "filter_broken"); ok {
+		t.Error("Expected no data point for the cache whose filter panicked")
+	}
+
+	errorsMetric := findMetric(rm, "cache.instrument.errors")
+	if errorsMetric == nil {
+		t.Fatal("cache.instrument.errors metric not found")
+	}
+	var panics int64
+	for _, dp := range errorsMetric.Data.(metricdata.Sum[int64]).DataPoints {
+		if errorType, _ := dp.Attributes.Value(errorTypeKey); errorType.AsString() == "panic" {
+			panics = dp.Value
+		}
+	}
+	// One panic for the dynamic attributes and one for each broken cache
+	if panics != 5 {
+		t.Errorf("Expected 5 panics to be counted, got %d", panics)
+	}
+	if len(recorder.errs) != 5 {
+		t.Errorf("Expected 5 panics to be reported, got %d", len(recorder.errs))
+	}
+}
+
+func TestObserveReportsRegistryHealth(t *testing.T) {
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(&errorRecorder{})
+	defer otel.SetErrorHandler(previous)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	instrumenter := New(WithMeterProvider(provider))
+	if err := instrumenter.Instrument(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 4}}, "healthy"); err != nil {
+		t.Fatalf("Failed to instrument healthy cache: %v", err)
+	}
+
+	// healthValue returns the value of cache.registry.healthy in the next collection
+	healthValue := func() int64 {
+		t.Helper()
+		m := findMetric(collectMetrics(t, reader), "cache.registry.healthy")
+		if m == nil {
+			t.Fatal("cache.registry.healthy metric not found")
+		}
+		dps := m.Data.(metricdata.Gauge[int64]).DataPoints
+		if len(dps) != 1 {
+			t.Fatalf("Expected 1 data point, got %d", len(dps))
+		}
+		return dps[0].Value
+	}
+
+	if got := healthValue(); got != 1 {
+		t.Errorf("Expected healthy registry to report 1, got %d", got)
+	}
+
+	if err := instrumenter.Instrument(&panickingCache{}, "broken"); err != nil {
+		t.Fatalf("Failed to instrument broken cache: %v", err)
+	}
+	if got := healthValue(); got != 0 {
+		t.Errorf("Expected 0 for a collection skipping a panicking cache, got %d", got)
+	}
+
+	// Health reflects the last collection only
+	if err := instrumenter.Uninstrument("broken"); err != nil {
+		t.Fatalf("Failed to uninstrument broken cache: %v", err)
+	}
+	if got := healthValue(); got != 1 {
+		t.Errorf("Expected 1 once the panicking cache is gone, got %d", got)
+	}
+}
+
+// countingCache is a MetricsProvider counting the calls to its Metrics method
+type countingCache struct {
+	calls atomic.Int64
+}
+
+func (c *countingCache) Metrics() freelru.Metrics {
+	return freelru.Metrics{Hits: uint64(c.calls.Add(1))}
+}
+
+func TestObserveWithSnapshotTTL(t *testing.T) {
+	current := time.Unix(0, 0)
+	previous := now
+	now = func() time.Time { return current }
+	defer func() { now = previous }()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := &countingCache{}
+	err := New().Instrument(cache, "throttled", WithMeterProvider(provider), WithSnapshotTTL(500*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		collectMetrics(t, reader)
+		current = current.Add(100 * time.Millisecond)
+	}
+	if calls := cache.calls.Load(); calls != 1 {
+		t.Errorf("Expected 1 Metrics call within the TTL, got %d", calls)
+	}
+
+	current = current.Add(500 * time.Millisecond)
+	collectMetrics(t, reader)
+	if calls := cache.calls.Load(); calls != 2 {
+		t.Errorf("Expected 2 Metrics calls after the TTL expired, got %d", calls)
+	}
+
+	if err := New().Instrument(&countingCache{}, "invalid", WithSnapshotTTL(0)); err == nil {
+		t.Error("Expected error for a zero snapshot TTL")
+	}
+}
+
+// BenchmarkObserveAttributes compares the attributes precomputed per cache with building them
+// on every collection
+func BenchmarkObserveAttributes(b *testing.B) {
+	cfg := newConfig()
+	WithAttributes(attribute.String("service", "checkout"), attribute.String("env", "prod"))(cfg)
+
+	entries := make([]*cacheEntry, 50)
+	for i := range entries {
+		entries[i] = &cacheEntry{
+			cache:        &metricsOnlyCache{},
+			reportedName: fmt.Sprintf("cache%d", i),
+		}
+	}
+
+	o := &countingObserver{}
+	var observable metric.Int64Observable
+
+	b.Run("precomputed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, entry := range entries {
+				o.ObserveInt64(observable, 1, entry.measurementOption(cfg))
+			}
+		}
+	})
+
+	b.Run("per_collection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, entry := range entries {
+				o.ObserveInt64(observable, 1, metric.WithAttributes(cfg.entryAttributes(entry)...))
+			}
+		}
+	})
+}
+
+func TestObserveCountsErrors(t *testing.T) {
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(&errorRecorder{})
+	defer otel.SetErrorHandler(previous)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: math.MaxUint64}}
+	if err := New().Instrument(cache, "overflow", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	errorsMetric := findMetric(rm, "cache.instrument.errors")
+	if errorsMetric == nil {
+		t.Fatal("cache.instrument.errors metric not found")
+	}
+	counts := make(map[string]int64)
+	for _, dp := range errorsMetric.Data.(metricdata.Sum[int64]).DataPoints {
+		errorType, _ := dp.Attributes.Value(errorTypeKey)
+		counts[errorType.AsString()] = dp.Value
+	}
+	if counts["clamp"] == 0 {
+		t.Error("Expected clamped counters to be counted as errors")
+	}
+	if counts["panic"] != 0 {
+		t.Errorf("Expected no panics, got %d", counts["panic"])
+	}
+}
+
+// slowCache is a MetricsProvider whose Metrics method blocks until release is closed
+type slowCache struct {
+	release chan struct{}
+}
+
+func (c *slowCache) Metrics() freelru.Metrics {
+	<-c.release
+	return freelru.Metrics{Hits: 1}
+}
+
+func TestObserveWithObserveTimeout(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	slow := &slowCache{release: make(chan struct{})}
+	defer close(slow.release)
+
+	instrumenter := New(WithMeterProvider(provider), WithObserveTimeout(10*time.Millisecond))
+	if err := instrumenter.Instrument(slow, "slow"); err != nil {
+		t.Fatalf("Failed to instrument slow cache: %v", err)
+	}
+	if err := instrumenter.Instrument(&metricsOnlyCache{metrics: freelru.Metrics{Hits: 4}}, "fast"); err != nil {
+		t.Fatalf("Failed to instrument fast cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	hitMetric := findMetric(rm, "cache.hit")
+	if hitMetric == nil {
+		t.Fatal("cache.hit metric not found")
+	}
+	dps := hitMetric.Data.(metricdata.Sum[int64]).DataPoints
+	if dp, ok := findDataPoint(dps, "fast"); !ok || dp.Value != 4 {
+		t.Errorf("Expected fast cache to report 4 hits, got %v (found %t)", dp.Value, ok)
+	}
+	if _, ok := findDataPoint(dps, "slow"); ok {
+		t.Error("Expected no data point for the slow cache")
+	}
+
+	errorsMetric := findMetric(rm, "cache.instrument.errors")
+	if errorsMetric == nil {
+		t.Fatal("cache.instrument.errors metric not found")
+	}
+	counts := make(map[string]int64)
+	for _, dp := range errorsMetric.Data.(metricdata.Sum[int64]).DataPoints {
+		errorType, _ := dp.Attributes.Value(errorTypeKey)
+		counts[errorType.AsString()] = dp.Value
+	}
+	if counts["timeout"] != 1 {
+		t.Errorf("Expected 1 timeout, got %d", counts["timeout"])
+	}
+
+	if err := New().Instrument(&metricsOnlyCache{}, "invalid", WithObserveTimeout(0)); err == nil {
+		t.Error("Expected an error for a non-positive timeout")
+	}
+}
+
+// stuckCache is a MetricsProvider whose Metrics method blocks until release is closed, counting
+// its calls
+type stuckCache struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (c *stuckCache) Metrics() freelru.Metrics {
+	c.calls.Add(1)
+	<-c.release
+	return freelru.Metrics{Hits: 1}
+}
+
+func TestObserveTimeoutKeepsOneReadInFlight(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	stuck := &stuckCache{release: make(chan struct{})}
+	instrumenter := New(WithMeterProvider(provider), WithObserveTimeout(10*time.Millisecond))
+	if err := instrumenter.Instrument(stuck, "stuck"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	// Collections while the first call is pending skip the cache without calling Metrics again
+	for i := 0; i < 3; i++ {
+		collectMetrics(t, reader)
+	}
+	if calls := stuck.calls.Load(); calls != 1 {
+		t.Errorf("Expected a single Metrics call in flight, got %d calls", calls)
+	}
+
+	// Once the pending call returned, the cache is read again
+	close(stuck.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hitMetric := findMetric(collectMetrics(t, reader), "cache.hit")
+		if hitMetric != nil {
+			if _, ok := findDataPoint(hitMetric.Data.(metricdata.Sum[int64]).DataPoints, "stuck"); ok {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the cache to be reported once Metrics returned")
+		}
+	}
+	if calls := stuck.calls.Load(); calls < 2 {
+		t.Errorf("Expected Metrics to be called again once the pending call returned, got %d calls", calls)
+	}
+}
+
+func TestRatioGaugesReportFullPrecision(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := &metricsOnlyCache{metrics: freelru.Metrics{Hits: 1, Misses: 2}}
+	if err := New().Instrument(cache, "precise", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	rm := collectMetrics(t, reader)
+
+	ratioMetric := findMetric(rm, "cache.hit_ratio")
+	if ratioMetric == nil {
+		t.Fatal("cache.hit_ratio metric not found")
+	}
+	gauge, ok := ratioMetric.Data.(metricdata.Gauge[float64])
+	if !ok {
+		t.Fatalf("Expected a float64 gauge, got %T", ratioMetric.Data)
+	}
+	if ratioMetric.Unit != "1" {
+		t.Errorf("Expected unit 1, got %s", ratioMetric.Unit)
+	}
+
+	dp, ok := findDataPoint(gauge.DataPoints, "precise")
+	if !ok {
+		t.Fatal("No cache.hit_ratio data point found")
+	}
+	// The ratio is reported unrounded, leaving the precision to the backend
+	if want := 1.0 / 3.0; dp.Value != want {
+		t.Errorf("Expected hit ratio %v, got %v", want, dp.Value)
+	}
+}
+
+// nilMeterProvider is a misconfigured MeterProvider returning no meter
+type nilMeterProvider struct {
+	embedded.MeterProvider
+}
+
+func (nilMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return nil
+}
+
+func TestInstrumentWithNilMeter(t *testing.T) {
+	instrumenter := New()
+
+	err := instrumenter.Instrument(&metricsOnlyCache{}, "nil_meter", WithMeterProvider(nilMeterProvider{}))
+	if !errors.Is(err, errNilMeter) {
+		t.Errorf("Expected errNilMeter for a provider returning a nil meter, got %v", err)
+	}
+	err = instrumenter.Instrument(&metricsOnlyCache{}, "nil_provider", WithMeterProvider(nil))
+	if !errors.Is(err, errNilMeter) {
+		t.Errorf("Expected errNilMeter for a nil provider, got %v", err)
+	}
+	if names := instrumenter.InstrumentedCaches(); len(names) != 0 {
+		t.Errorf("Expected the caches not to be instrumented, got %v", names)
+	}
+
+	// The no-op provider returns a meter, so instrumenting succeeds
+	if err := instrumenter.Instrument(&metricsOnlyCache{}, "noop", WithMeterProvider(noop.NewMeterProvider())); err != nil {
+		t.Errorf("Failed to instrument cache with the no-op provider: %v", err)
+	}
+}
+
+// orderObserver records the cache names of the observations of a single instrument in order
+type orderObserver struct {
+	embedded.Observer
+	instrument metric.Int64Observable
+	names      []string
+}
+
+func (o *orderObserver) ObserveFloat64(metric.Float64Observable, float64, ...metric.ObserveOption) {}
+
+func (o *orderObserver) ObserveInt64(obs metric.Int64Observable, _ int64, opts ...metric.ObserveOption) {
+	if obs != o.instrument {
+		return
+	}
+	attrs := metric.NewObserveConfig(opts).Attributes()
+	name, _ := attrs.Value(defaultCacheNameKey)
+	o.names = append(o.names, name.AsString())
+}
+
+func TestObserveInNameOrder(t *testing.T) {
+	registry := &cacheRegistry{}
+	names := []string{"delta", "alpha", "echo", "charlie", "bravo"}
+	for _, name := range names {
+		entry := &cacheEntry{cache: &metricsOnlyCache{}, reportedName: name}
+		if err := registry.add(entry, name); err != nil {
+			t.Fatalf("Failed to add cache: %v", err)
+		}
+	}
+	reg := mustRegisterAllMetrics(t, newConfig(), registry)
+
+	o := &orderObserver{instrument: reg.counters[0].observer}
+	if err := reg.observe(context.Background(), o); err != nil {
+		t.Fatalf("Failed to observe: %v", err)
+	}
+
+	expected := []string{"alpha", "bravo", "charlie", "delta", "echo"}
+	if fmt.Sprint(o.names) != fmt.Sprint(expected) {
+		t.Errorf("Expected observations in order %v, got %v", expected, o.names)
+	}
+}
+
+func TestObserveLastObserved(t *testing.T) {
+	current := time.Unix(1700000000, 0)
+	previous := now
+	now = func() time.Time { return current }
+	defer func() { now = previous }()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := &metricsOnlyCache{}
+	if err := New().Instrument(cache, "observed", WithMeterProvider(provider)); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	lastObserved := func() float64 {
+		t.Helper()
+		rm := collectMetrics(t, reader)
+		m := findMetric(rm, "cache.last_observed")
+		if m == nil {
+			t.Fatal("cache.last_observed metric not found")
+		}
+		dp, ok := findDataPoint(m.Data.(metricdata.Gauge[float64]).DataPoints, "observed")
+		if !ok {
+			t.Fatal("No cache.last_observed data point found")
+		}
+		return dp.Value
+	}
+
+	first := lastObserved()
+	if first != 1700000000 {
+		t.Errorf("Expected the first observation at 1700000000, got %v", first)
+	}
+
+	current = current.Add(30 * time.Second)
+	if second := lastObserved(); second != first+30 {
+		t.Errorf("Expected the timestamp to advance to %v, got %v", first+30, second)
+	}
+}
+
+// newObserveRegistration returns a registration observing n caches
+func newObserveRegistration(tb testing.TB, n int) *registration {
+	tb.Helper()
+
+	registry := &cacheRegistry{}
+	for i := 0; i < n; i++ {
+		entry := &cacheEntry{cache: &metricsOnlyCache{}, reportedName: fmt.Sprintf("cache%d", i)}
+		if err := registry.add(entry, entry.reportedName); err != nil {
+			tb.Fatalf("Failed to add cache: %v", err)
+		}
+	}
+
+	meter := sdkmetric.NewMeterProvider().Meter("test")
+	reg, err := registerAllMetrics(meter, newConfig(), registry)
+	if err != nil {
+		tb.Fatalf("Failed to register metrics: %v", err)
+	}
+	return reg
+}
+
+func TestObserveAllocationsPerCache(t *testing.T) {
+	ctx := context.Background()
+	o := &countingObserver{}
+
+	allocs := func(n int) float64 {
+		reg := newObserveRegistration(t, n)
+		return testing.AllocsPerRun(100, func() {
+			if err := reg.observe(ctx, o); err != nil {
+				t.Fatalf("Failed to observe: %v", err)
+			}
+		})
+	}
+
+	// The allocations of a collection don't grow with the number of caches
+	if few, many := allocs(2), allocs(20); many != few {
+		t.Errorf("Expected no allocations per cache, got %v allocations for 2 caches and %v for 20", few, many)
+	}
+}
+
+func BenchmarkObserve(b *testing.B) {
+	for _, numCaches := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("caches=%d", numCaches), func(b *testing.B) {
+			reg := newObserveRegistration(b, numCaches)
+			ctx := context.Background()
+			o := &countingObserver{}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := reg.observe(ctx, o); err != nil {
+					b.Fatalf("Failed to observe: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestObserveSkipsNilCache(t *testing.T) {
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(&errorRecorder{})
+	defer otel.SetErrorHandler(previous)
+
+	// Instrument rejects nil caches, so add one to the registry directly
+	registry := &cacheRegistry{}
+	if err := registry.add(&cacheEntry{reportedName: "nil"}, "nil"); err != nil {
+		t.Fatalf("Failed to add cache: %v", err)
+	}
+	if err := registry.add(&cacheEntry{cache: &metricsOnlyCache{}, reportedName: "healthy"}, "healthy"); err != nil {
+		t.Fatalf("Failed to add cache: %v", err)
+	}
+	reg := mustRegisterAllMetrics(t, newConfig(), registry)
+
+	o := &orderObserver{instrument: reg.counters[0].observer}
+	if err := reg.observe(context.Background(), o); err != nil {
+		t.Fatalf("Failed to observe: %v", err)
+	}
+	if fmt.Sprint(o.names) != "[healthy]" {
+		t.Errorf("Expected only the healthy cache to be observed, got %v", o.names)
+	}
+	if reg.panicErrors.Load() != 1 {
+		t.Errorf("Expected the nil cache to be counted as an error, got %d", reg.panicErrors.Load())
+	}
+}
@@ -2,50 +2,525 @@ package freelruotel
 
 import (
 	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// cacheEntry holds an instrumented cache together with its per-cache attributes
+type cacheEntry struct {
+	// id identifies the entry across replacements, assigned by the registry
+	id uint64
+
+	cache      MetricsProvider
+	attributes []attribute.KeyValue
+
+	// expired counts expired entries not removed yet, nil unless set with WithExpiredFunc
+	expired func() int
+
+	// reportedName is the sanitized name reported as the cache name attribute
+	reportedName string
+
+	// kind is the kind of cache reported as the cache_type attribute
+	kind string
+
+	// shards is the number of shards of a freelru cache, 0 for other caches
+	shards int
+
+	// capacity is the capacity of a freelru cache, 0 for other caches
+	capacity int
+
+	// created is when the cache was instrumented or replaced, i.e. when its counters started
+	created time.Time
+
+	// stop unregisters the removal of the entry set up by InstrumentCtx, nil if there's none.
+	// It's guarded by the registry lock and called when the entry is removed.
+	stop func() bool
+
+	// lastObserved is the time of the last successful observation in Unix nanoseconds, 0 if never
+	lastObserved atomic.Int64
+
+	// disabled suspends reporting without removing the cache
+	disabled atomic.Bool
+
+	// purges counts the purges recorded by RecordPurge, as freelru doesn't track them
+	purges atomic.Uint64
+
+	// hits and misses count the lookups recorded by RecordHit and RecordMiss, which are added to
+	// the metrics of the cache
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	// attrs caches the attributes of the data points per config, as computing them allocates
+	attrsMu sync.Mutex
+	attrs   map[*config]entryAttributes
+
+	// pending receives the result of a Metrics call that timed out while it hasn't returned yet, nil
+	// if there's none
+	readMu  sync.Mutex
+	pending chan metricsResult
+
+	// snapshot caches the last metrics read for WithSnapshotTTL
+	snapshotMu sync.Mutex
+	snapshot   freelru.Metrics
+	snapshotAt time.Time
+}
+
+// entryAttributes holds the attributes of the data points of an entry under a config
+type entryAttributes struct {
+	measurement metric.MeasurementOption
+
+	// observe holds measurement as the variadic options of Observe calls, as building the slice
+	// on every call allocates
+	observe []metric.ObserveOption
+}
+
+// attributesFor returns the attributes of the data points of e under cfg, computing them on first use
+func (e *cacheEntry) attributesFor(cfg *config) entryAttributes {
+	e.attrsMu.Lock()
+	defer e.attrsMu.Unlock()
+
+	attrs, ok := e.attrs[cfg]
+	if !ok {
+		opt := metric.WithAttributeSet(attribute.NewSet(cfg.entryAttributes(e)...))
+		attrs = entryAttributes{measurement: opt, observe: []metric.ObserveOption{opt}}
+		if e.attrs == nil {
+			e.attrs = make(map[*config]entryAttributes)
+		}
+		e.attrs[cfg] = attrs
+	}
+	return attrs
+}
+
+// capacityOf returns the capacity of the cache of e: the result of Cap for CapacityProviders, which
+// takes precedence over the capacity detected for freelru caches. ok is false for other caches.
+func (e *cacheEntry) capacityOf() (capacity int, ok bool) {
+	if capper, ok := e.cache.(CapacityProvider); ok {
+		return capper.Cap(), true
+	}
+	return e.capacity, e.capacity > 0
+}
+
+// measurementOption returns the attributes of the data points of e under cfg
+func (e *cacheEntry) measurementOption(cfg *config) metric.MeasurementOption {
+	return e.attributesFor(cfg).measurement
+}
+
+// observeOptions returns the attributes of the data points of e under cfg as options of Observe
+// calls, which can be passed without allocating
+func (e *cacheEntry) observeOptions(cfg *config) []metric.ObserveOption {
+	return e.attributesFor(cfg).observe
+}
+
+// freelruKinds maps the freelru cache types to their cache_type attribute values
+var freelruKinds = map[string]string{
+	"LRU":        "lru",
+	"SyncedLRU":  "synced",
+	"ShardedLRU": "sharded",
+}
+
+// cacheKind returns the kind of cache: the result of Kind for KindProviders, the freelru variant
+// for freelru caches and "unknown" otherwise
+func cacheKind(cache MetricsProvider) string {
+	if kinder, ok := cache.(KindProvider); ok {
+		return kinder.Kind()
+	}
+
+	if kind, ok := freelruKinds[freelruTypeName(cache)]; ok {
+		return kind
+	}
+	return "unknown"
+}
+
+// freelruTypeName returns the name of the freelru type of cache without its type parameters,
+// e.g. "ShardedLRU", or "" if cache isn't a pointer to a freelru type. freelru caches are generic,
+// so they're recognized by name rather than by a type switch.
+func freelruTypeName(cache MetricsProvider) string {
+	t := reflect.TypeOf(cache)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().PkgPath() != "github.com/elastic/go-freelru" {
+		return ""
+	}
+	name, _, _ := strings.Cut(t.Elem().Name(), "[")
+	return name
+}
+
+// freelruShards returns the number of shards of a freelru cache: 1 for LRU and SyncedLRU, and the
+// number of shards a ShardedLRU was created with. It returns 0 for other caches.
+func freelruShards(cache MetricsProvider) int {
+	switch freelruTypeName(cache) {
+	case "LRU", "SyncedLRU":
+		return 1
+	case "ShardedLRU":
+		// ShardedLRU doesn't expose its shards, but the length of its unexported slice of shards
+		// can be read without accessing the shards themselves
+		v := reflect.ValueOf(cache)
+		if v.IsNil() {
+			return 0
+		}
+		if shards := v.Elem().FieldByName("lrus"); shards.Kind() == reflect.Slice {
+			return shards.Len()
+		}
+	}
+	return 0
+}
+
+// freelruCapacity returns the capacity of a freelru cache, which for a ShardedLRU is the capacity it
+// was created with rounded up to a multiple of its number of shards. It returns 0 for other caches.
+func freelruCapacity(cache MetricsProvider) int {
+	v := reflect.ValueOf(cache)
+	switch freelruTypeName(cache) {
+	case "LRU":
+		return lruCapacity(v)
+	case "SyncedLRU":
+		if v.IsNil() {
+			return 0
+		}
+		return lruCapacity(v.Elem().FieldByName("lru"))
+	case "ShardedLRU":
+		if v.IsNil() {
+			return 0
+		}
+		shards := v.Elem().FieldByName("lrus")
+		if shards.Kind() != reflect.Slice {
+			return 0
+		}
+		var capacity int
+		for i := 0; i < shards.Len(); i++ {
+			capacity += lruCapacity(shards.Index(i))
+		}
+		return capacity
+	}
+	return 0
+}
+
+// lruCapacity reads the unexported capacity of a freelru LRU, given as a value or a pointer, or
+// returns 0 if it isn't found
+func lruCapacity(v reflect.Value) int {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	if capacity := v.FieldByName("cap"); capacity.CanUint() {
+		return int(capacity.Uint())
+	}
+	return 0
+}
+
+// now returns the current time, replaced in tests
+var now = time.Now
+
+// metrics returns the metrics of the cache plus the recorded lookups. With a positive ttl, metrics
+// read less than ttl ago are reused instead of calling Metrics again. With a positive timeout, Metrics
+// taking longer is given up with errObserveTimeout. A panic in Metrics is returned as an error.
+func (e *cacheEntry) metrics(ttl, timeout time.Duration) (freelru.Metrics, error) {
+	metrics, err := e.cacheMetrics(ttl, timeout)
+	if err != nil {
+		return metrics, err
+	}
+	return e.withRecorded(metrics), nil
+}
+
+// withRecorded returns metrics with the lookups recorded by RecordHit and RecordMiss added
+func (e *cacheEntry) withRecorded(metrics freelru.Metrics) freelru.Metrics {
+	metrics.Hits = addSaturating(metrics.Hits, e.hits.Load())
+	metrics.Misses = addSaturating(metrics.Misses, e.misses.Load())
+	return metrics
+}
+
+// cacheMetrics returns the metrics of the cache itself, reusing metrics read less than ttl ago
+func (e *cacheEntry) cacheMetrics(ttl, timeout time.Duration) (freelru.Metrics, error) {
+	if ttl <= 0 {
+		return e.readMetricsTimeout(timeout)
+	}
+
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+
+	t := now()
+	if !e.snapshotAt.IsZero() && t.Sub(e.snapshotAt) < ttl {
+		return e.snapshot, nil
+	}
+	metrics, err := e.readMetricsTimeout(timeout)
+	if err != nil {
+		return metrics, err
+	}
+	e.snapshot, e.snapshotAt = metrics, t
+	return metrics, nil
+}
+
 // cacheRegistry manages a collection of instrumented caches with thread-safe access
 type cacheRegistry struct {
 	sync.RWMutex
-	caches map[string]MetricsProvider
+	caches map[string]*cacheEntry
+	lastID uint64
+
+	// byInstance and byReportedName index the names of the caches by pointer and by reported name,
+	// so adding a cache doesn't scan the registry
+	byInstance     map[MetricsProvider]string
+	byReportedName map[string]string
 }
 
 // add stores a new cache in the registry, returning error if name already exists
-func (r *cacheRegistry) add(cache MetricsProvider, name string) error {
+// or the same cache instance is already stored under another name
+func (r *cacheRegistry) add(entry *cacheEntry, name string) error {
 	r.Lock()
 	defer r.Unlock()
 	
 	if r.caches == nil {
-		r.caches = make(map[string]MetricsProvider)
+		r.caches = make(map[string]*cacheEntry)
+		r.byInstance = make(map[MetricsProvider]string)
+		r.byReportedName = make(map[string]string)
 	}
 	
 	if _, exists := r.caches[name]; exists {
 		return fmt.Errorf("cache with name '%s' already exists", name)
 	}
-	
-	r.caches[name] = cache
+	if existingName, exists := r.nameOf(entry.cache); exists {
+		return fmt.Errorf("cache is already instrumented with name '%s'", existingName)
+	}
+	if existingName, exists := r.byReportedName[entry.reportedName]; exists {
+		return fmt.Errorf("cache name '%s' is reported as '%s' like the cache '%s'",
+			name, entry.reportedName, existingName)
+	}
+
+	r.lastID++
+	entry.id = r.lastID
+	r.caches[name] = entry
+	if isInstance(entry.cache) {
+		r.byInstance[entry.cache] = name
+	}
+	r.byReportedName[entry.reportedName] = name
+	return nil
+}
+
+// removeEntry deletes the cache stored under name if it's the entry with the given id,
+// reporting whether it was removed
+func (r *cacheRegistry) removeEntry(name string, id uint64) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	entry, exists := r.caches[name]
+	if !exists || entry.id != id {
+		return false
+	}
+	r.delete(name, entry)
+	return true
+}
+
+// watch stores stop on the entry stored under name if it's the entry with the given id, reporting
+// whether it was stored. stop is called once the entry is removed.
+func (r *cacheRegistry) watch(name string, id uint64, stop func() bool) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	entry, exists := r.caches[name]
+	if !exists || entry.id != id {
+		return false
+	}
+	entry.stop = stop
+	return true
+}
+
+// delete removes entry stored under name and stops watching its context. The lock must be held.
+func (r *cacheRegistry) delete(name string, entry *cacheEntry) {
+	if entry.stop != nil {
+		entry.stop()
+	}
+	delete(r.caches, name)
+	if isInstance(entry.cache) {
+		delete(r.byInstance, entry.cache)
+	}
+	delete(r.byReportedName, entry.reportedName)
+}
+
+// replace swaps the cache stored under name for cache, keeping the attributes and state of the entry.
+// It returns an error if name doesn't exist or cache is already stored under another name.
+func (r *cacheRegistry) replace(name string, cache MetricsProvider) error {
+	r.Lock()
+	defer r.Unlock()
+
+	previous, exists := r.caches[name]
+	if !exists {
+		return fmt.Errorf("cache with name '%s' does not exist", name)
+	}
+	if existingName, exists := r.nameOf(cache); exists && existingName != name {
+		return fmt.Errorf("cache is already instrumented with name '%s'", existingName)
+	}
+
+	// Swap in a new entry rather than updating the cache in place, as entries are read outside the lock
+	entry := &cacheEntry{
+		id:           previous.id,
+		cache:        cache,
+		attributes:   previous.attributes,
+		reportedName: previous.reportedName,
+		kind:         cacheKind(cache),
+		shards:       freelruShards(cache),
+		capacity:     freelruCapacity(cache),
+		created:      now(),
+		expired:      previous.expired,
+		stop:         previous.stop,
+	}
+	entry.disabled.Store(previous.disabled.Load())
+	entry.purges.Store(previous.purges.Load())
+	entry.hits.Store(previous.hits.Load())
+	entry.lastObserved.Store(previous.lastObserved.Load())
+	entry.misses.Store(previous.misses.Load())
+	r.caches[name] = entry
+	if isInstance(previous.cache) {
+		delete(r.byInstance, previous.cache)
+	}
+	if isInstance(cache) {
+		r.byInstance[cache] = name
+	}
 	return nil
 }
 
-// forEach iterates over all caches
-func (r *cacheRegistry) forEach(fn func(string, MetricsProvider)) {
+// nameOf returns the name the same cache instance is stored under, if any. The lock must be held.
+func (r *cacheRegistry) nameOf(cache MetricsProvider) (string, bool) {
+	if !isInstance(cache) {
+		return "", false
+	}
+	name, exists := r.byInstance[cache]
+	return name, exists
+}
+
+// isInstance reports whether cache is a pointer, whose instance can be told apart from others. Other
+// values aren't indexed, as hashing interfaces holding e.g. funcs or slices panics.
+func isInstance(cache MetricsProvider) bool {
+	return reflect.ValueOf(cache).Kind() == reflect.Pointer
+}
+
+// get returns the entry registered under name
+func (r *cacheRegistry) get(name string) (*cacheEntry, bool) {
 	r.RLock()
 	defer r.RUnlock()
-	for name, cache := range r.caches {
-		fn(name, cache)
+
+	entry, exists := r.caches[name]
+	return entry, exists
+}
+
+// remove deletes a cache from the registry, returning error if name doesn't exist
+func (r *cacheRegistry) remove(name string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	entry, exists := r.caches[name]
+	if !exists {
+		return fmt.Errorf("cache with name '%s' does not exist", name)
 	}
+
+	r.delete(name, entry)
+	return nil
 }
 
-// reset clears all caches (used in tests)
-func (r *cacheRegistry) reset() {
+// clear removes all caches from the registry
+func (r *cacheRegistry) clear() {
 	r.Lock()
 	defer r.Unlock()
-	r.caches = make(map[string]MetricsProvider)
+	for name, entry := range r.caches {
+		r.delete(name, entry)
+	}
+	r.caches = nil
+	r.byInstance = nil
+	r.byReportedName = nil
+}
+
+// len returns the number of caches
+func (r *cacheRegistry) len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.caches)
+}
+
+// names returns the sorted names of all caches
+func (r *cacheRegistry) names() []string {
+	r.RLock()
+	names := make([]string, 0, len(r.caches))
+	for name := range r.caches {
+		names = append(names, name)
+	}
+	r.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// oldest returns the ids of the n caches added first
+func (r *cacheRegistry) oldest(n int) map[uint64]struct{} {
+	r.RLock()
+	ids := make([]uint64, 0, len(r.caches))
+	for _, entry := range r.caches {
+		ids = append(ids, entry.id)
+	}
+	r.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+
+	oldest := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		oldest[id] = struct{}{}
+	}
+	return oldest
+}
+
+// namedEntry is a cache entry together with the name it's registered under
+type namedEntry struct {
+	name  string
+	entry *cacheEntry
+}
+
+// entries returns a snapshot of the caches taken under the lock
+func (r *cacheRegistry) entries() []namedEntry {
+	r.RLock()
+	defer r.RUnlock()
+
+	entries := make([]namedEntry, 0, len(r.caches))
+	for name, entry := range r.caches {
+		entries = append(entries, namedEntry{name, entry})
+	}
+	return entries
+}
+
+// forEach iterates over all caches until fn returns false. It iterates over a snapshot of the
+// caches taken under the lock, so fn can take its time without blocking changes to the registry.
+func (r *cacheRegistry) forEach(fn func(string, *cacheEntry) bool) {
+	for _, e := range r.entries() {
+		if !fn(e.name, e.entry) {
+			return
+		}
+	}
+}
+
+// forEachSorted iterates over all caches in name order like forEach, so the data points of a
+// collection are produced in a stable order
+func (r *cacheRegistry) forEachSorted(fn func(string, *cacheEntry) bool) {
+	entries := r.entries()
+	slices.SortFunc(entries, func(a, b namedEntry) int { return strings.Compare(a.name, b.name) })
+
+	for _, e := range entries {
+		if !fn(e.name, e.entry) {
+			return
+		}
+	}
 }
 
-// resetForTesting resets both registry and metrics registration for tests
+// resetForTesting replaces the default Instrumenter, dropping its caches and metrics registrations
 func resetForTesting() {
-	registry.reset()
-	metricsOnce = sync.Once{}
+	defaultInstrumenter = New()
 }
@@ -0,0 +1,219 @@
+package freelruotel
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestCacheRegistryGet(t *testing.T) {
+	registry := &cacheRegistry{}
+
+	if _, exists := registry.get("missing"); exists {
+		t.Error("Expected get on an empty registry to report a missing cache")
+	}
+
+	entry := &cacheEntry{cache: mustCreateLRUCache()}
+	if err := registry.add(entry, "present"); err != nil {
+		t.Fatalf("Failed to add cache: %v", err)
+	}
+
+	got, exists := registry.get("present")
+	if !exists {
+		t.Fatal("Expected get to find the added cache")
+	}
+	if got != entry {
+		t.Error("Expected get to return the added entry")
+	}
+
+	if _, exists := registry.get("missing"); exists {
+		t.Error("Expected get to report a missing cache")
+	}
+}
+
+func TestCacheRegistryRemove(t *testing.T) {
+	registry := &cacheRegistry{}
+
+	if err := registry.remove("missing"); err == nil {
+		t.Error("Expected error removing a missing cache")
+	}
+
+	if err := registry.add(&cacheEntry{cache: mustCreateLRUCache()}, "present"); err != nil {
+		t.Fatalf("Failed to add cache: %v", err)
+	}
+	if err := registry.remove("present"); err != nil {
+		t.Fatalf("Failed to remove cache: %v", err)
+	}
+
+	if _, exists := registry.get("present"); exists {
+		t.Error("Expected removed cache to be gone")
+	}
+	if err := registry.remove("present"); err == nil {
+		t.Error("Expected error removing a cache twice")
+	}
+}
+
+func TestCacheRegistryIndexes(t *testing.T) {
+	registry := &cacheRegistry{}
+
+	first, second := mustCreateLRUCache(), mustCreateLRUCache()
+	if err := registry.add(&cacheEntry{cache: first, reportedName: "first"}, "first"); err != nil {
+		t.Fatalf("Failed to add cache: %v", err)
+	}
+	if err := registry.add(&cacheEntry{cache: first, reportedName: "again"}, "again"); err == nil {
+		t.Error("Expected error adding the same instance under another name")
+	}
+	if err := registry.add(&cacheEntry{cache: second, reportedName: "first"}, "First"); err == nil {
+		t.Error("Expected error adding a cache reported under the same name")
+	}
+
+	// Replacing the cache frees the previous instance and claims the new one
+	if err := registry.replace("first", second); err != nil {
+		t.Fatalf("Failed to replace cache: %v", err)
+	}
+	if err := registry.add(&cacheEntry{cache: first, reportedName: "other"}, "other"); err != nil {
+		t.Errorf("Expected the replaced instance to be free, got %v", err)
+	}
+	if err := registry.add(&cacheEntry{cache: second, reportedName: "third"}, "third"); err == nil {
+		t.Error("Expected error adding the replacing instance under another name")
+	}
+
+	// Removing the cache frees its instance and its reported name
+	if err := registry.remove("first"); err != nil {
+		t.Fatalf("Failed to remove cache: %v", err)
+	}
+	if err := registry.add(&cacheEntry{cache: second, reportedName: "first"}, "First"); err != nil {
+		t.Errorf("Expected the instance and reported name of the removed cache to be free, got %v", err)
+	}
+
+	// Values that aren't pointers can't be told apart, so they're never taken for the same instance
+	stats := MetricsFunc(func() freelru.Metrics { return freelru.Metrics{} })
+	for _, name := range []string{"stats1", "stats2"} {
+		if err := registry.add(&cacheEntry{cache: stats, reportedName: name}, name); err != nil {
+			t.Errorf("Failed to add func cache %s: %v", name, err)
+		}
+	}
+}
+
+// blockingCache is a MetricsProvider whose Metrics method blocks until released
+type blockingCache struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) Metrics() freelru.Metrics {
+	c.entered <- struct{}{}
+	<-c.release
+	return freelru.Metrics{}
+}
+
+func TestCacheRegistryWritesDuringCollection(t *testing.T) {
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+	instrumenter := New(WithMeterProvider(provider))
+
+	cache := &blockingCache{entered: make(chan struct{}), release: make(chan struct{})}
+	if err := instrumenter.Instrument(cache, "slow"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	collected := make(chan error, 1)
+	go func() {
+		var rm metricdata.ResourceMetrics
+		collected <- reader.Collect(context.Background(), &rm)
+	}()
+	<-cache.entered
+
+	// The collection is stuck in Metrics, which must not block changes to the registry
+	added := make(chan error, 1)
+	go func() {
+		added <- instrumenter.Instrument(mustCreateLRUCache(), "added_during_collection")
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Errorf("Failed to instrument cache during collection: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Instrumenting a cache was blocked by the collection")
+	}
+
+	close(cache.release)
+	if err := <-collected; err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+}
+
+// TestFreelruShardsField pins the unexported field freelruShards reads the shards of a ShardedLRU from,
+// so a freelru upgrade renaming or retyping it fails here instead of silently dropping cache.shards
+func TestFreelruShardsField(t *testing.T) {
+	field, ok := reflect.TypeOf(freelru.ShardedLRU[string, string]{}).FieldByName("lrus")
+	if !ok {
+		t.Fatal("freelru.ShardedLRU has no field lrus anymore, freelruShards needs to be updated")
+	}
+	if field.Type.Kind() != reflect.Slice {
+		t.Fatalf("Expected freelru.ShardedLRU.lrus to be a slice, got %s", field.Type.Kind())
+	}
+
+	for _, shards := range []uint32{1, 4, 16} {
+		cache, err := freelru.NewShardedWithSize[string, string](shards, 1024, 1024, hashStringXXHASH)
+		if err != nil {
+			t.Fatalf("Failed to create cache with %d shards: %v", shards, err)
+		}
+		if got := freelruShards(cache); got != int(shards) {
+			t.Errorf("Expected %d shards, got %d", shards, got)
+		}
+	}
+	if got := freelruShards(mustCreateSyncedCache()); got != 1 {
+		t.Errorf("Expected 1 shard for a SyncedLRU, got %d", got)
+	}
+	if got := freelruShards(&metricsOnlyCache{}); got != 0 {
+		t.Errorf("Expected no shards for a non-freelru cache, got %d", got)
+	}
+}
+
+// TestFreelruCapacityFields pins the unexported fields freelruCapacity reads the capacity of freelru
+// caches from, so a freelru upgrade renaming or retyping them fails here instead of silently dropping
+// cache.capacity, cache.load and cache.capacity_utilization
+func TestFreelruCapacityFields(t *testing.T) {
+	field, ok := reflect.TypeOf(freelru.LRU[string, string]{}).FieldByName("cap")
+	if !ok {
+		t.Fatal("freelru.LRU has no field cap anymore, freelruCapacity needs to be updated")
+	}
+	if field.Type.Kind() != reflect.Uint32 {
+		t.Fatalf("Expected freelru.LRU.cap to be a uint32, got %s", field.Type.Kind())
+	}
+	field, ok = reflect.TypeOf(freelru.SyncedLRU[string, string]{}).FieldByName("lru")
+	if !ok {
+		t.Fatal("freelru.SyncedLRU has no field lru anymore, freelruCapacity needs to be updated")
+	}
+	if field.Type != reflect.TypeOf(&freelru.LRU[string, string]{}) {
+		t.Fatalf("Expected freelru.SyncedLRU.lru to be a *freelru.LRU, got %s", field.Type)
+	}
+
+	if got := freelruCapacity(mustCreateLRUCache()); got != 10 {
+		t.Errorf("Expected capacity 10 for an LRU, got %d", got)
+	}
+	if got := freelruCapacity(mustCreateSyncedCache()); got != 10 {
+		t.Errorf("Expected capacity 10 for a SyncedLRU, got %d", got)
+	}
+
+	// NewSharded splits the capacity evenly across its shards, rounding it up to a multiple of them
+	const capacity = 1000
+	sharded, err := freelru.NewSharded[string, string](capacity, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	shards := freelruShards(sharded)
+	if want := (capacity + shards - 1) / shards * shards; freelruCapacity(sharded) != want {
+		t.Errorf("Expected capacity %d for a ShardedLRU with %d shards, got %d", want, shards, freelruCapacity(sharded))
+	}
+	if got := freelruCapacity(&metricsOnlyCache{}); got != 0 {
+		t.Errorf("Expected no capacity for a non-freelru cache, got %d", got)
+	}
+}
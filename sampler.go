@@ -0,0 +1,129 @@
+package freelruotel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// utilizationBuckets are the histogram bucket boundaries of cache.capacity_utilization
+var utilizationBuckets = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 0.95, 1}
+
+// UtilizationSampler records the fill ratio, Len()/Cap(), of every instrumented freelru cache and
+// cache implementing SizeProvider and CapacityProvider into the cache.capacity_utilization histogram
+// at a fixed interval.
+//
+// Observable instruments can't record histograms, so unlike the other metrics, the histogram is
+// sampled by a goroutine rather than at collection time. The interval sets the sampling cadence
+// independently of the collection interval: sampling every second and collecting every minute
+// records 60 observations per cache per collection.
+type UtilizationSampler struct {
+	cfg       *config
+	registry  *cacheRegistry
+	histogram metric.Float64Histogram
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartUtilizationSampler starts sampling the caches instrumented by i every interval, using the
+// MeterProvider and attributes set by opts. Call Stop on the returned sampler to end sampling.
+// If cache.capacity_utilization is disabled with WithDisabledMetrics, the sampler doesn't sample.
+func (i *Instrumenter) StartUtilizationSampler(interval time.Duration, opts ...Option) (*UtilizationSampler, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("sampling interval must be positive, got %s", interval)
+	}
+	cfg := i.config(opts)
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	if cfg.disabled[MetricCacheCapacityUtilization] {
+		// Nothing to run, so Stop returns right away
+		s := &UtilizationSampler{cfg: cfg, registry: i.registry, stop: make(chan struct{}), done: make(chan struct{})}
+		close(s.done)
+		return s, nil
+	}
+
+	meter := cfg.meter()
+	if meter == nil {
+		return nil, errNilMeter
+	}
+	histogram, err := meter.Float64Histogram(cfg.metricName(MetricCacheCapacityUtilization),
+		metric.WithDescription(cfg.description(MetricCacheCapacityUtilization)),
+		metric.WithUnit(cfg.unit(MetricCacheCapacityUtilization)),
+		metric.WithExplicitBucketBoundaries(utilizationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &UtilizationSampler{
+		cfg:       cfg,
+		registry:  i.registry,
+		histogram: histogram,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run(interval)
+	return s, nil
+}
+
+// run samples every interval until Stop is called
+func (s *UtilizationSampler) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sample(context.Background())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sample records the fill ratio of every enabled cache reporting its size and capacity
+func (s *UtilizationSampler) sample(ctx context.Context) {
+	s.registry.forEach(func(name string, entry *cacheEntry) bool {
+		if entry.disabled.Load() {
+			return true
+		}
+		if err := s.sampleEntry(ctx, entry); err != nil {
+			// Skip the cache, so one broken cache neither stops the others nor the sampler
+			otel.Handle(fmt.Errorf("freelruotel: cache '%s': %w", name, err))
+		}
+		return true
+	})
+}
+
+// sampleEntry records the fill ratio of entry, recovering a panic in Len or Cap as an error
+func (s *UtilizationSampler) sampleEntry(ctx context.Context, entry *cacheEntry) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic sampling the utilization: %v", p)
+		}
+	}()
+
+	sizer, hasSize := entry.cache.(SizeProvider)
+	capacity, hasCap := entry.capacityOf()
+	if !hasSize || !hasCap {
+		return nil
+	}
+	s.histogram.Record(ctx, load(sizer.Len(), capacity), entry.measurementOption(s.cfg))
+	return nil
+}
+
+// Stop ends sampling and waits for a running sample to finish. It can be called more than once.
+func (s *UtilizationSampler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
@@ -0,0 +1,99 @@
+package freelruotel
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-freelru"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestUtilizationSampler(t *testing.T) {
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	// A single shard keeps the effective capacity equal to the requested one
+	sharded, err := freelru.NewShardedWithSize[string, string](1, 10, 16, hashStringXXHASH)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	instrumenter := New(WithMeterProvider(provider))
+	if err := instrumenter.Instrument(sharded, "sampled"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	if err := instrumenter.Instrument(uncappedCache{mustCreateLRUCache()}, "uncapped"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	// The interval is long enough for the ticker never to fire, so the test drives sampling
+	sampler, err := instrumenter.StartUtilizationSampler(time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to start sampler: %v", err)
+	}
+	defer sampler.Stop()
+
+	for i := 0; i < 3; i++ {
+		sharded.Add(fmt.Sprintf("key%d", i), "value")
+		sampler.sample(context.Background())
+	}
+
+	rm := collectMetrics(t, reader)
+	utilization := findMetric(rm, "cache.capacity_utilization")
+	if utilization == nil {
+		t.Fatal("cache.capacity_utilization metric not found")
+	}
+	dps := utilization.Data.(metricdata.Histogram[float64]).DataPoints
+	if len(dps) != 1 {
+		t.Fatalf("Expected data points for the sampled cache only, got %d", len(dps))
+	}
+	if name, _ := dps[0].Attributes.Value(defaultCacheNameKey); name.AsString() != "sampled" {
+		t.Errorf("Expected data point for cache sampled, got %s", name.Emit())
+	}
+	if dps[0].Count != 3 {
+		t.Errorf("Expected 3 observations, got %d", dps[0].Count)
+	}
+	if sum := dps[0].Sum; sum < 0.6-1e-9 || sum > 0.6+1e-9 {
+		t.Errorf("Expected observations summing to 0.6, got %f", sum)
+	}
+}
+
+func TestUtilizationSamplerStop(t *testing.T) {
+	sampler, err := New().StartUtilizationSampler(time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to start sampler: %v", err)
+	}
+
+	sampler.Stop()
+	sampler.Stop()
+
+	if _, err := New().StartUtilizationSampler(0); err == nil {
+		t.Error("Expected error for a zero interval")
+	}
+}
+
+func TestUtilizationSamplerDisabled(t *testing.T) {
+	// Create manual reader to collect metrics
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	instrumenter := New(WithMeterProvider(provider))
+	if err := instrumenter.Instrument(cappedCache{mustCreateShardedCache(), 10}, "sampled"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	sampler, err := instrumenter.StartUtilizationSampler(time.Millisecond,
+		WithDisabledMetrics(MetricCacheCapacityUtilization))
+	if err != nil {
+		t.Fatalf("Failed to start sampler: %v", err)
+	}
+	sampler.Stop()
+
+	if findMetric(collectMetrics(t, reader), "cache.capacity_utilization") != nil {
+		t.Error("Expected no cache.capacity_utilization metric while it's disabled")
+	}
+}
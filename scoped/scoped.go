@@ -0,0 +1,32 @@
+// Package scoped builds MeterProviders reporting cache metrics with a Resource of their own, for
+// processes hosting several logical services. The Resource belongs to the MeterProvider rather than
+// to an instrumentation scope, so every service needs its own provider, passed to freelruotel with
+// WithMeterProvider.
+package scoped
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// serviceNameKey is the semantic convention attribute naming the service
+const serviceNameKey = "service.name"
+
+// ServiceResource returns the default Resource with service.name set to serviceName and attrs added,
+// e.g. service.namespace. attrs override the default Resource but not the service name.
+func ServiceResource(serviceName string, attrs ...attribute.KeyValue) (*resource.Resource, error) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs)+1)
+	kvs = append(kvs, attrs...)
+	kvs = append(kvs, attribute.String(serviceNameKey, serviceName))
+
+	return resource.Merge(resource.Default(), resource.NewSchemaless(kvs...))
+}
+
+// NewMeterProvider returns a MeterProvider reporting its metrics with res. opts are applied before
+// res, e.g. sdkmetric.WithReader; like sdkmetric.WithResource, the attributes of the
+// OTEL_RESOURCE_ATTRIBUTES environment variable are added to res.
+func NewMeterProvider(res *resource.Resource, opts ...sdkmetric.Option) *sdkmetric.MeterProvider {
+	opts = append(opts[:len(opts):len(opts)], sdkmetric.WithResource(res))
+	return sdkmetric.NewMeterProvider(opts...)
+}
@@ -0,0 +1,59 @@
+package scoped
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/go-freelru"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestNewMeterProvider(t *testing.T) {
+	res, err := ServiceResource("checkout", attribute.String("service.namespace", "shop"))
+	if err != nil {
+		t.Fatalf("Failed to build resource: %v", err)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	provider := NewMeterProvider(res, sdkmetric.WithReader(reader))
+
+	metrics := freelruotel.MetricsFunc(func() freelru.Metrics { return freelru.Metrics{Hits: 1} })
+	if err := freelruotel.New(freelruotel.WithMeterProvider(provider)).Instrument(metrics, "scoped"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	if len(rm.ScopeMetrics) == 0 {
+		t.Fatal("Expected cache metrics")
+	}
+
+	expected := map[attribute.Key]string{
+		"service.name":      "checkout",
+		"service.namespace": "shop",
+	}
+	for key, value := range expected {
+		if got, ok := rm.Resource.Set().Value(key); !ok || got.AsString() != value {
+			t.Errorf("Expected resource attribute %s=%s, got %s", key, value, got.Emit())
+		}
+	}
+	// The default attributes are kept
+	if _, ok := rm.Resource.Set().Value("telemetry.sdk.name"); !ok {
+		t.Error("Expected the default resource attributes")
+	}
+}
+
+func TestServiceResourceKeepsServiceName(t *testing.T) {
+	res, err := ServiceResource("checkout", attribute.String(serviceNameKey, "overridden"))
+	if err != nil {
+		t.Fatalf("Failed to build resource: %v", err)
+	}
+	if got, _ := res.Set().Value(serviceNameKey); got.AsString() != "checkout" {
+		t.Errorf("Expected service.name checkout, got %s", got.AsString())
+	}
+}
@@ -0,0 +1,78 @@
+package freelruotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// missEventName is the name of the span event recorded by Get on a cache miss.
+const missEventName = "cache.miss"
+
+// Getter is the lookup method of freelru caches.
+type Getter[K comparable, V any] interface {
+	Get(key K) (V, bool)
+}
+
+// MissRecorder records "cache.miss" span events for the cache with a given name. The cache name
+// key and the reported name are resolved once when it's created, so recording a miss doesn't
+// evaluate any option.
+type MissRecorder struct {
+	event trace.EventOption
+}
+
+// NewMissRecorder creates a MissRecorder for the cache with the given name. Pass the options the cache
+// was instrumented with, so the events carry the cache name key set by WithCacheNameKey and the name
+// as reported by WithNameSanitizer. It returns an error if an option is invalid.
+func NewMissRecorder(name string, opts ...Option) (*MissRecorder, error) {
+	cfg := newConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	return &MissRecorder{
+		event: trace.WithAttributes(attribute.String(cfg.cacheNameKey, cfg.reportedName(name))),
+	}, nil
+}
+
+// RecordMiss records a "cache.miss" event on the span in ctx, if it's recording.
+func (r *MissRecorder) RecordMiss(ctx context.Context) {
+	span := trace.SpanFromContext(ctx)
+	if span.IsRecording() {
+		span.AddEvent(missEventName, r.event)
+	}
+}
+
+// GetRecorded looks up key in cache and, on a miss, records a "cache.miss" event with r, like Get.
+func GetRecorded[K comparable, V any](ctx context.Context, r *MissRecorder, cache Getter[K, V], key K) (V, bool) {
+	value, ok := cache.Get(key)
+	if !ok {
+		r.RecordMiss(ctx)
+	}
+	return value, ok
+}
+
+// Get looks up key in cache and, on a miss, records a "cache.miss" event carrying the cache name
+// on the span in ctx, so misses can be correlated with the request that caused them. Pass the options
+// the cache was instrumented with, like for NewMissRecorder. Options are evaluated on every recorded
+// miss, so prefer a MissRecorder with GetRecorded on hot paths. If an option is invalid, the error is
+// reported to the OpenTelemetry error handler and no event is recorded.
+//
+// The observable counters are collected outside of any request, so they can't carry trace exemplars;
+// use Get for the lookups that should show up in traces.
+func Get[K comparable, V any](ctx context.Context, cache Getter[K, V], name string, key K, opts ...Option) (V, bool) {
+	value, ok := cache.Get(key)
+	if !ok && trace.SpanFromContext(ctx).IsRecording() {
+		r, err := NewMissRecorder(name, opts...)
+		if err != nil {
+			otel.Handle(err)
+			return value, ok
+		}
+		r.RecordMiss(ctx)
+	}
+	return value, ok
+}
@@ -0,0 +1,151 @@
+package freelruotel
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGetRecordsMissEvent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	cache := mustCreateSyncedCache()
+	cache.Add("key", "value")
+
+	ctx, span := tracer.Start(context.Background(), "request")
+
+	if value, ok := Get[string, string](ctx, cache, "traced", "key"); !ok || value != "value" {
+		t.Errorf("Expected hit with value, got %q, %v", value, ok)
+	}
+	if _, ok := Get[string, string](ctx, cache, "traced", "missing"); ok {
+		t.Error("Expected miss")
+	}
+
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+
+	events := spans[0].Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected only the miss to record an event, got %d events", len(events))
+	}
+	if events[0].Name != "cache.miss" {
+		t.Errorf("Expected event cache.miss, got %s", events[0].Name)
+	}
+
+	var cacheName string
+	for _, attr := range events[0].Attributes {
+		if attr.Key == "cache_name" {
+			cacheName = attr.Value.AsString()
+		}
+	}
+	if cacheName != "traced" {
+		t.Errorf("Expected cache_name traced, got %q", cacheName)
+	}
+}
+
+func TestGetRecordsMissEventWithOptions(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "request")
+	_, ok := Get[string, string](ctx, mustCreateLRUCache(), "user sessions", "missing",
+		WithCacheNameKey("cache.name"), WithNameSanitizer(SanitizeName))
+	if ok {
+		t.Error("Expected miss")
+	}
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || len(spans[0].Events()) != 1 {
+		t.Fatalf("Expected a single span with the miss event, got %d spans", len(spans))
+	}
+
+	attrs := spans[0].Events()[0].Attributes
+	if len(attrs) != 1 || attrs[0].Key != "cache.name" {
+		t.Fatalf("Expected only the cache.name attribute, got %v", attrs)
+	}
+	if want := SanitizeName("user sessions"); attrs[0].Value.AsString() != want {
+		t.Errorf("Expected cache.name %q, got %q", want, attrs[0].Value.AsString())
+	}
+}
+
+func TestGetWithoutSpan(t *testing.T) {
+	cache := mustCreateLRUCache()
+
+	// Lookups without a span in the context don't record anything and still work
+	if _, ok := Get[string, string](context.Background(), cache, "untraced", "missing"); ok {
+		t.Error("Expected miss")
+	}
+}
+
+func TestGetRecordedReusesRecorder(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	misses, err := NewMissRecorder("user sessions", WithCacheNameKey("cache.name"), WithNameSanitizer(SanitizeName))
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	cache := mustCreateLRUCache()
+	cache.Add("key", "value")
+
+	ctx, span := tracer.Start(context.Background(), "request")
+	if _, ok := GetRecorded[string, string](ctx, misses, cache, "key"); !ok {
+		t.Error("Expected hit")
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := GetRecorded[string, string](ctx, misses, cache, "missing"); ok {
+			t.Error("Expected miss")
+		}
+	}
+	span.End()
+
+	events := recorder.Ended()[0].Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected an event for each miss, got %d events", len(events))
+	}
+	for _, event := range events {
+		if len(event.Attributes) != 1 || event.Attributes[0].Key != "cache.name" ||
+			event.Attributes[0].Value.AsString() != SanitizeName("user sessions") {
+			t.Errorf("Expected only the sanitized cache.name attribute, got %v", event.Attributes)
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { misses.RecordMiss(context.Background()) }); allocs != 0 {
+		t.Errorf("Expected no allocations recording a miss without a span, got %v", allocs)
+	}
+}
+
+func TestGetReportsInvalidOptions(t *testing.T) {
+	errs := &errorRecorder{}
+	previous := otel.GetErrorHandler()
+	otel.SetErrorHandler(errs)
+	defer otel.SetErrorHandler(previous)
+
+	if _, err := NewMissRecorder("invalid", WithCacheNameKey("")); err == nil {
+		t.Error("Expected error creating a recorder with an invalid option")
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "request")
+	if _, ok := Get[string, string](ctx, mustCreateLRUCache(), "invalid", "missing", WithCacheNameKey("")); ok {
+		t.Error("Expected miss")
+	}
+	span.End()
+
+	if len(errs.errs) != 1 {
+		t.Errorf("Expected the invalid option to be reported once, got %v", errs.errs)
+	}
+	if events := recorder.Ended()[0].Events(); len(events) != 0 {
+		t.Errorf("Expected no event with an invalid option, got %d", len(events))
+	}
+}
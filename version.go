@@ -0,0 +1,43 @@
+package freelruotel
+
+import "runtime/debug"
+
+// modulePath is the import path of this module.
+const modulePath = "github.com/sweet-tv/freelru-otel"
+
+// fallbackVersion is reported when the module version isn't recorded in the build info.
+const fallbackVersion = "v0.2.0"
+
+// version is the current version of the instrumentation library.
+var version = moduleVersion()
+
+// moduleVersion returns the version of this module from the build info of the running binary.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return fallbackVersion
+	}
+	return versionFromBuildInfo(info)
+}
+
+// versionFromBuildInfo returns the version of this module recorded in info, or fallbackVersion
+// when it's built from a local checkout, e.g. under go test.
+func versionFromBuildInfo(info *debug.BuildInfo) string {
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		if dep.Version != "" && dep.Version != "(devel)" {
+			return dep.Version
+		}
+	}
+
+	if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return fallbackVersion
+}
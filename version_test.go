@@ -0,0 +1,64 @@
+package freelruotel
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestVersionFallbackUnderTest(t *testing.T) {
+	if got := moduleVersion(); got != fallbackVersion {
+		t.Errorf("Expected fallback version %s under go test, got %s", fallbackVersion, got)
+	}
+	if version != fallbackVersion {
+		t.Errorf("Expected version %s, got %s", fallbackVersion, version)
+	}
+}
+
+func TestVersionFromBuildInfo(t *testing.T) {
+	testCases := []struct {
+		name     string
+		info     *debug.BuildInfo
+		expected string
+	}{
+		{
+			name:     "empty",
+			info:     &debug.BuildInfo{},
+			expected: fallbackVersion,
+		},
+		{
+			name: "dependency",
+			info: &debug.BuildInfo{
+				Main: debug.Module{Path: "example.com/app", Version: "(devel)"},
+				Deps: []*debug.Module{
+					{Path: "github.com/elastic/go-freelru", Version: "v0.16.0"},
+					{Path: modulePath, Version: "v0.3.1"},
+				},
+			},
+			expected: "v0.3.1",
+		},
+		{
+			name: "replaced dependency",
+			info: &debug.BuildInfo{
+				Deps: []*debug.Module{
+					{Path: modulePath, Version: "v0.3.1", Replace: &debug.Module{Path: "example.com/fork", Version: "v0.3.2"}},
+				},
+			},
+			expected: "v0.3.2",
+		},
+		{
+			name: "main module checkout",
+			info: &debug.BuildInfo{
+				Main: debug.Module{Path: modulePath, Version: "(devel)"},
+			},
+			expected: fallbackVersion,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := versionFromBuildInfo(tc.info); got != tc.expected {
+				t.Errorf("Expected version %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package view
+
+import (
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// DeltaTemporalitySelector returns a selector reporting counters and histograms as deltas and
+// up-down counters as cumulative values, as recommended for delta-preferring backends.
+// Pass it to the reader or exporter, e.g. with sdkmetric.WithTemporalitySelector.
+//
+// The cache counters are cumulative observable counters, which the SDK converts to deltas between
+// collections. freelru resets its counters on Purge, which shows up as a negative delta.
+func DeltaTemporalitySelector() sdkmetric.TemporalitySelector {
+	return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+		switch kind {
+		case sdkmetric.InstrumentKindCounter,
+			sdkmetric.InstrumentKindObservableCounter,
+			sdkmetric.InstrumentKindHistogram:
+			return metricdata.DeltaTemporality
+		}
+		return metricdata.CumulativeTemporality
+	}
+}
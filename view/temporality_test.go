@@ -0,0 +1,55 @@
+package view
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/go-freelru"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+	"github.com/sweet-tv/freelru-otel/freelruoteltest"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestDeltaTemporalitySelector(t *testing.T) {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(DeltaTemporalitySelector()))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cache := freelruoteltest.NewFakeCache(freelru.Metrics{Hits: 5})
+	if err := freelruotel.New(freelruotel.WithMeterProvider(provider)).Instrument(cache, "delta"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	// hits collects the cache.hit sum
+	hits := func() metricdata.Sum[int64] {
+		t.Helper()
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatalf("Failed to collect metrics: %v", err)
+		}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name == "cache.hit" {
+					return m.Data.(metricdata.Sum[int64])
+				}
+			}
+		}
+		t.Fatal("cache.hit metric not found")
+		return metricdata.Sum[int64]{}
+	}
+
+	first := hits()
+	if first.Temporality != metricdata.DeltaTemporality {
+		t.Fatalf("Expected delta temporality, got %s", first.Temporality)
+	}
+	if len(first.DataPoints) != 1 || first.DataPoints[0].Value != 5 {
+		t.Fatalf("Expected a first delta of 5, got %+v", first.DataPoints)
+	}
+
+	cache.Update(func(m *freelru.Metrics) { m.Hits += 3 })
+
+	second := hits()
+	if len(second.DataPoints) != 1 || second.DataPoints[0].Value != 3 {
+		t.Errorf("Expected a delta of 3 after 3 more hits, got %+v", second.DataPoints)
+	}
+}
@@ -0,0 +1,51 @@
+// Package view provides OpenTelemetry SDK views for the cache metrics, so callers don't need
+// to hand-write them when constructing their MeterProvider, and a temporality selector for
+// pipelines preferring delta counters.
+//
+// The views select the metrics by the default instrumentation scope and metric names; they don't
+// apply to metrics renamed with WithMetricPrefix or registered under a scope set with WithMeterName.
+package view
+
+import (
+	freelruotel "github.com/sweet-tv/freelru-otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// recommendedKeys are the attribute keys set by the instrumentation itself
+var recommendedKeys = []attribute.Key{
+	freelruotel.AttributeCacheName,
+	freelruotel.AttributeCacheType,
+	freelruotel.AttributeDeployment,
+	freelruotel.AttributeErrorType,
+	freelruotel.AttributeNamespace,
+	freelruotel.AttributeResult,
+}
+
+// cacheMetrics selects every cache metric of the default instrumentation scope
+var cacheMetrics = sdkmetric.Instrument{
+	Name:  "cache.*",
+	Scope: instrumentation.Scope{Name: freelruotel.DefaultScopeName},
+}
+
+// RecommendedViews returns views keeping the attributes set by the instrumentation, like cache_name,
+// and dropping any other attribute, e.g. ones added with WithAttributes that would multiply the number
+// of series. Pass them to sdkmetric.WithView when creating the MeterProvider.
+func RecommendedViews() []sdkmetric.View {
+	return []sdkmetric.View{
+		sdkmetric.NewView(cacheMetrics, sdkmetric.Stream{
+			AttributeFilter: attribute.NewAllowKeysFilter(recommendedKeys...),
+		}),
+	}
+}
+
+// WithoutCacheName returns views dropping the cache_name attribute, for deployments with too many
+// caches to report each of them. Counters of all caches are then summed into a single series.
+func WithoutCacheName() []sdkmetric.View {
+	return []sdkmetric.View{
+		sdkmetric.NewView(cacheMetrics, sdkmetric.Stream{
+			AttributeFilter: attribute.NewDenyKeysFilter(freelruotel.AttributeCacheName),
+		}),
+	}
+}
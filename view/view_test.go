@@ -0,0 +1,119 @@
+package view
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/elastic/go-freelru"
+	freelruotel "github.com/sweet-tv/freelru-otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectHits instruments caches with hits under their names and returns the cache.hit data points
+func collectHits(t *testing.T, views []sdkmetric.View, hits map[string]uint64) []metricdata.DataPoint[int64] {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(views...))
+
+	instrumenter := freelruotel.New(freelruotel.WithMeterProvider(provider), freelruotel.WithDeployment("canary"),
+		freelruotel.WithAttributes(attribute.String("request_id", "abc123")))
+	for name, h := range hits {
+		metrics := freelru.Metrics{Hits: h}
+		fn := func() freelru.Metrics { return metrics }
+		if err := instrumenter.Instrument(freelruotel.MetricsFunc(fn), name); err != nil {
+			t.Fatalf("Failed to instrument cache %s: %v", name, err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == "cache.hit" {
+				return m.Data.(metricdata.Sum[int64]).DataPoints
+			}
+		}
+	}
+	t.Fatal("cache.hit metric not found")
+	return nil
+}
+
+func TestRecommendedViews(t *testing.T) {
+	dps := collectHits(t, RecommendedViews(), map[string]uint64{"sessions": 3})
+
+	if len(dps) != 1 {
+		t.Fatalf("Expected 1 data point, got %d", len(dps))
+	}
+	if name, ok := dps[0].Attributes.Value("cache_name"); !ok || name.AsString() != "sessions" {
+		t.Errorf("Expected cache_name=sessions, got %v", name.Emit())
+	}
+	if _, ok := dps[0].Attributes.Value("cache_type"); !ok {
+		t.Error("Expected cache_type attribute to be kept")
+	}
+	if stage, ok := dps[0].Attributes.Value("deployment"); !ok || stage.AsString() != "canary" {
+		t.Errorf("Expected deployment=canary to be kept, got %v", stage.Emit())
+	}
+	if _, ok := dps[0].Attributes.Value("request_id"); ok {
+		t.Error("Expected request_id attribute to be dropped")
+	}
+	if dps[0].Value != 3 {
+		t.Errorf("Expected 3 hits, got %d", dps[0].Value)
+	}
+}
+
+func TestWithoutCacheName(t *testing.T) {
+	dps := collectHits(t, WithoutCacheName(), map[string]uint64{"sessions": 3, "products": 4})
+
+	if len(dps) != 1 {
+		t.Fatalf("Expected the caches to be merged into 1 data point, got %d", len(dps))
+	}
+	if _, ok := dps[0].Attributes.Value("cache_name"); ok {
+		t.Error("Expected cache_name attribute to be dropped")
+	}
+	if dps[0].Value != 7 {
+		t.Errorf("Expected 7 hits across caches, got %d", dps[0].Value)
+	}
+}
+
+func TestRecommendedViewsKeepErrorType(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(RecommendedViews()...))
+
+	instrumenter := freelruotel.New(freelruotel.WithMeterProvider(provider))
+	clamped := func() freelru.Metrics { return freelru.Metrics{Hits: math.MaxUint64} }
+	if err := instrumenter.Instrument(freelruotel.MetricsFunc(clamped), "clamped"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+	panicking := func() freelru.Metrics { panic("broken cache") }
+	if err := instrumenter.Instrument(freelruotel.MetricsFunc(panicking), "panicking"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+
+	errorTypes := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "cache.instrument.errors" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				errorType, _ := dp.Attributes.Value("error.type")
+				errorTypes[errorType.AsString()] = dp.Value
+			}
+		}
+	}
+	// Without error.type the series would be merged into one
+	if errorTypes["clamp"] != 1 || errorTypes["panic"] != 1 {
+		t.Errorf("Expected a clamp and a panic series with 1 error each, got %v", errorTypes)
+	}
+}
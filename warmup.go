@@ -0,0 +1,89 @@
+package freelruotel
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// warmupSpanName is the name of the span started by WarmCache.
+const warmupSpanName = "cache.warmup"
+
+// warmupEntriesKey is the span attribute holding the number of entries after a warmup.
+const warmupEntriesKey = "cache.warmup.entries"
+
+// WarmCache runs fn to populate the cache with the given name, e.g. at startup, in a "cache.warmup"
+// span started from ctx with the TracerProvider set by WithTracerProvider. The duration is recorded
+// on the "cache.warmup.duration" histogram of the MeterProvider set by opts, unless it's disabled with
+// WithDisabledMetrics. If a cache implementing SizeProvider is instrumented under name, its number of
+// entries afterwards is recorded on the "cache.warmup.size" gauge and carried by the span as
+// "cache.warmup.entries". An error returned by fn is recorded on the span and returned.
+func (i *Instrumenter) WarmCache(ctx context.Context, name string, fn func() error, opts ...Option) error {
+	cfg := i.config(opts)
+	if cfg.err != nil {
+		return cfg.err
+	}
+	if fn == nil {
+		return errors.New("warmup function must not be nil")
+	}
+
+	meter := cfg.meter()
+	if meter == nil {
+		return errNilMeter
+	}
+	// Warmups are rare, and the meter returns the same instruments for every call
+	var duration metric.Float64Histogram
+	if !cfg.disabled[MetricCacheWarmupDuration] {
+		var err error
+		duration, err = meter.Float64Histogram(cfg.metricName(MetricCacheWarmupDuration),
+			metric.WithDescription(cfg.description(MetricCacheWarmupDuration)),
+			metric.WithUnit(cfg.unit(MetricCacheWarmupDuration)))
+		if err != nil {
+			return err
+		}
+	}
+	var size metric.Int64Gauge
+	if !cfg.disabled[MetricCacheWarmupSize] {
+		var err error
+		size, err = meter.Int64Gauge(cfg.metricName(MetricCacheWarmupSize),
+			metric.WithDescription(cfg.description(MetricCacheWarmupSize)),
+			metric.WithUnit(cfg.unit(MetricCacheWarmupSize)))
+		if err != nil {
+			return err
+		}
+	}
+
+	kvs := make([]attribute.KeyValue, 0, len(cfg.attributes)+2)
+	kvs = append(kvs, cfg.attributes...)
+	kvs = cfg.appendNamespace(kvs)
+	kvs = append(kvs, attribute.String(cfg.cacheNameKey, cfg.reportedName(name)))
+
+	tracer := cfg.tracerProvider.Tracer(cfg.meterName, trace.WithInstrumentationVersion(cfg.meterVersion))
+	ctx, span := tracer.Start(ctx, warmupSpanName, trace.WithAttributes(kvs...))
+	defer span.End()
+
+	start := now()
+	fnErr := fn()
+	if duration != nil {
+		duration.Record(ctx, now().Sub(start).Seconds(), metric.WithAttributes(kvs...))
+	}
+
+	if entry, ok := i.registry.get(name); ok {
+		if sizer, ok := entry.cache.(SizeProvider); ok {
+			entries := sizer.Len()
+			span.SetAttributes(attribute.Int(warmupEntriesKey, entries))
+			if size != nil {
+				size.Record(ctx, int64(entries), metric.WithAttributes(kvs...))
+			}
+		}
+	}
+	if fnErr != nil {
+		span.RecordError(fnErr)
+		span.SetStatus(codes.Error, fnErr.Error())
+	}
+	return fnErr
+}
@@ -0,0 +1,137 @@
+package freelruotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttribute returns the value of the attribute of span with the given key
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestWarmCacheRecordsSpanAndDuration(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	reader := sdkmetric.NewManualReader()
+	instrumenter := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithTracerProvider(tracerProvider))
+
+	cache := mustCreateSyncedCache()
+	if err := instrumenter.Instrument(cache, "warm"); err != nil {
+		t.Fatalf("Failed to instrument cache: %v", err)
+	}
+
+	err := instrumenter.WarmCache(context.Background(), "warm", func() error {
+		for i := 0; i < 3; i++ {
+			cache.Add(fmt.Sprintf("key%d", i), "value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to warm cache: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name() != "cache.warmup" {
+		t.Errorf("Expected span cache.warmup, got %s", spans[0].Name())
+	}
+	if got, _ := spanAttribute(spans[0], "cache_name"); got.AsString() != "warm" {
+		t.Errorf("Expected cache_name warm, got %s", got.Emit())
+	}
+	if got, _ := spanAttribute(spans[0], "cache.warmup.entries"); got.AsInt64() != 3 {
+		t.Errorf("Expected cache.warmup.entries 3 after the warmup, got %s", got.Emit())
+	}
+
+	rm := collectMetrics(t, reader)
+	durationMetric := findMetric(rm, "cache.warmup.duration")
+	if durationMetric == nil {
+		t.Fatal("cache.warmup.duration metric not found")
+	}
+	dps := durationMetric.Data.(metricdata.Histogram[float64]).DataPoints
+	if len(dps) != 1 || dps[0].Count != 1 {
+		t.Fatalf("Expected a single warmup to be recorded, got %+v", dps)
+	}
+	if got, _ := dps[0].Attributes.Value("cache_name"); got.AsString() != "warm" {
+		t.Errorf("Expected cache_name warm, got %s", got.Emit())
+	}
+
+	sizeMetric := findMetric(rm, "cache.warmup.size")
+	if sizeMetric == nil {
+		t.Fatal("cache.warmup.size metric not found")
+	}
+	sizes := sizeMetric.Data.(metricdata.Gauge[int64]).DataPoints
+	if len(sizes) != 1 || sizes[0].Value != 3 {
+		t.Fatalf("Expected a size of 3 after the warmup, got %+v", sizes)
+	}
+	if got, _ := sizes[0].Attributes.Value("cache_name"); got.AsString() != "warm" {
+		t.Errorf("Expected cache_name warm, got %s", got.Emit())
+	}
+}
+
+func TestWarmCacheDisabledDuration(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	instrumenter := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+
+	var warmed bool
+	err := instrumenter.WarmCache(context.Background(), "warm", func() error {
+		warmed = true
+		return nil
+	}, WithDisabledMetrics(MetricCacheWarmupDuration))
+	if err != nil {
+		t.Fatalf("Failed to warm cache: %v", err)
+	}
+	if !warmed {
+		t.Error("Expected the warmup function to run while the duration is disabled")
+	}
+
+	if findMetric(collectMetrics(t, reader), "cache.warmup.duration") != nil {
+		t.Error("Expected no cache.warmup.duration metric while it's disabled")
+	}
+}
+
+func TestWarmCacheRecordsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	instrumenter := New(WithMeterProvider(sdkmetric.NewMeterProvider()), WithTracerProvider(tracerProvider))
+
+	// Caches don't need to be instrumented to be warmed up
+	failure := errors.New("backend unavailable")
+	err := instrumenter.WarmCache(context.Background(), "cold", func() error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the warmup error, got %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("Expected error status, got %v", spans[0].Status())
+	}
+	if _, ok := spanAttribute(spans[0], "cache.warmup.entries"); ok {
+		t.Error("Expected no cache.warmup.entries without an instrumented cache")
+	}
+
+	if err := instrumenter.WarmCache(context.Background(), "cold", nil); err == nil {
+		t.Error("Expected error for a nil warmup function")
+	}
+}